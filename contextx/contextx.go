@@ -10,8 +10,23 @@ type Key int
 
 const (
 	ID Key = iota
+	TraceID
+	SpanID
+	Subject
+	Auth
+	Tenant
 )
 
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject  string
+	Issuer   string
+	Audience []string
+	Scopes   []string
+	Roles    []string
+	Claims   map[string]interface{}
+}
+
 func AddID(ctx context.Context) context.Context {
 	return context.WithValue(ctx, ID, uuid.New().String())
 }
@@ -31,3 +46,61 @@ func SetID(ctx context.Context, id string) context.Context {
 func WithID() context.Context {
 	return context.WithValue(context.Background(), ID, uuid.New().String())
 }
+
+func GetTraceID(ctx context.Context) string {
+	if id, ok := ctx.Value(TraceID).(string); ok {
+		return id
+	}
+
+	return ""
+}
+
+func SetTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, TraceID, id)
+}
+
+func GetSpanID(ctx context.Context) string {
+	if id, ok := ctx.Value(SpanID).(string); ok {
+		return id
+	}
+
+	return ""
+}
+
+func SetSpanID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, SpanID, id)
+}
+
+func GetSubject(ctx context.Context) string {
+	if subject, ok := ctx.Value(Subject).(string); ok {
+		return subject
+	}
+
+	return ""
+}
+
+func SetSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, Subject, subject)
+}
+
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(Auth).(*Principal)
+	return p, ok
+}
+
+func SetPrincipal(ctx context.Context, p *Principal) context.Context {
+	ctx = SetSubject(ctx, p.Subject)
+	return context.WithValue(ctx, Auth, p)
+}
+
+func GetTenant(ctx context.Context) string {
+	if tenant, ok := ctx.Value(Tenant).(string); ok {
+		return tenant
+	}
+
+	return ""
+}
+
+func SetTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, Tenant, tenant)
+}
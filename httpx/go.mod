@@ -4,6 +4,6 @@ go 1.16
 
 require (
 	github.com/sirupsen/logrus v1.8.1
-	github.com/tOnkowzl/libs/contextx v0.0.4
-	github.com/tOnkowzl/libs/logx v0.0.28
+	github.com/tOnkowzl/libs/contextx v0.0.5
+	github.com/tOnkowzl/libs/logx v0.0.29
 )
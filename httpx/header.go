@@ -8,6 +8,7 @@ const (
 	TextXML         = "text/xml; charset=utf-8"
 
 	HeaderXRequestID    = "X-Request-ID"
+	HeaderXTenantID     = "X-Tenant-ID"
 	HeaderAuthorization = "Authorization"
 )
 
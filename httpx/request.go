@@ -87,6 +87,12 @@ func (r *Request) initRequireHeaders(ctx context.Context) {
 	if _, ok := r.Header[HeaderXRequestID]; !ok {
 		r.addHeader(HeaderXRequestID, contextx.GetID(ctx))
 	}
+
+	if tenant := contextx.GetTenant(ctx); tenant != "" {
+		if _, ok := r.Header[HeaderXTenantID]; !ok {
+			r.addHeader(HeaderXTenantID, tenant)
+		}
+	}
 }
 
 func (r *Request) initFullURL(baseurl string) {
@@ -60,43 +60,52 @@ func LimitMSGString(s string) string {
 	return s
 }
 
+// contextFields returns the request scoped fields carried by ctx.
+func contextFields(ctx context.Context) logrus.Fields {
+	fields := logrus.Fields{"id": contextx.GetID(ctx)}
+	if id := contextx.GetTraceID(ctx); id != "" {
+		fields["trace_id"] = id
+	}
+	if id := contextx.GetSpanID(ctx); id != "" {
+		fields["span_id"] = id
+	}
+	if subject := contextx.GetSubject(ctx); subject != "" {
+		fields["subject"] = subject
+	}
+	if tenant := contextx.GetTenant(ctx); tenant != "" {
+		fields["tenant"] = tenant
+	}
+	return fields
+}
+
+func withSeverity(ctx context.Context, severity Severity) logrus.FieldLogger {
+	fields := contextFields(ctx)
+	fields[severityKey] = severity
+	return logrus.WithFields(fields)
+}
+
 func WithContext(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithField("id", contextx.GetID(ctx))
+	return logrus.WithFields(contextFields(ctx))
 }
 
 func WithSeverityInfo(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithFields(logrus.Fields{
-		"id":        contextx.GetID(ctx),
-		severityKey: SeverityInfo,
-	})
+	return withSeverity(ctx, SeverityInfo)
 }
 
 func WithSeverityDebug(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithFields(logrus.Fields{
-		"id":        contextx.GetID(ctx),
-		severityKey: SeverityDebug,
-	})
+	return withSeverity(ctx, SeverityDebug)
 }
 
 func WithSeverityWarn(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithFields(logrus.Fields{
-		"id":        contextx.GetID(ctx),
-		severityKey: SeverityWarn,
-	})
+	return withSeverity(ctx, SeverityWarn)
 }
 
 func WithSeverityError(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithFields(logrus.Fields{
-		"id":        contextx.GetID(ctx),
-		severityKey: SeverityError,
-	})
+	return withSeverity(ctx, SeverityError)
 }
 
 func WithSeverityEmergency(ctx context.Context) logrus.FieldLogger {
-	return logrus.WithFields(logrus.Fields{
-		"id":        contextx.GetID(ctx),
-		severityKey: SeverityEmergency,
-	})
+	return withSeverity(ctx, SeverityEmergency)
 }
 
 func WithField(key string, value interface{}) *logrus.Entry {
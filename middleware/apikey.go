@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// APIKeyIssuer is the principal issuer of API key authenticated requests.
+const APIKeyIssuer = "api-key"
+
+// APIKeyRecord is a stored API key. Only the hash of the key is kept.
+type APIKeyRecord struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the key is expired at t.
+func (k *APIKeyRecord) Expired(t time.Time) bool {
+	return k.ExpiresAt != nil && !t.Before(*k.ExpiresAt)
+}
+
+// HashAPIKey returns the hex SHA-256 hash under which key is stored.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyStore looks up keys by hash. Lookup returns nil and no error for
+// unknown hashes.
+type APIKeyStore interface {
+	Lookup(ctx context.Context, hash string) (*APIKeyRecord, error)
+}
+
+// APIKeyConfig defines the config for APIKey middleware.
+type APIKeyConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Store holds the hashed keys. Required.
+	Store APIKeyStore
+
+	// Header is the request header carrying the key.
+	// Default is X-Api-Key.
+	Header string
+
+	// QueryParam is the query parameter carrying the key when the header
+	// is absent. Empty disables it; keys in URLs tend to end up in logs.
+	QueryParam string
+
+	// CacheTTL is how long lookups, including unknown keys, are cached.
+	// Default is 1 minute.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum number of keys cached.
+	// Default is 10000.
+	CacheSize int
+}
+
+var (
+	// DefaultAPIKeyConfig is the default APIKey middleware config.
+	DefaultAPIKeyConfig = APIKeyConfig{
+		Skipper:   DefaultSkipper,
+		Header:    HeaderXAPIKey,
+		CacheTTL:  time.Minute,
+		CacheSize: 10000,
+	}
+)
+
+// APIKey returns a middleware authenticating requests by the X-Api-Key
+// header against store.
+func APIKey(store APIKeyStore) echo.MiddlewareFunc {
+	config := DefaultAPIKeyConfig
+	config.Store = store
+	return APIKeyWithConfig(config)
+}
+
+// APIKeyWithConfig returns an APIKey middleware with config. The key owner
+// becomes the principal subject, with the key scopes, so logx lines carry it
+// and RequireScopes applies to API keys as it does to JWTs.
+func APIKeyWithConfig(config APIKeyConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultAPIKeyConfig.Skipper
+	}
+	if config.Store == nil {
+		panic("echo: api key middleware requires a store")
+	}
+	if config.Header == "" {
+		config.Header = DefaultAPIKeyConfig.Header
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultAPIKeyConfig.CacheTTL
+	}
+	if config.CacheSize == 0 {
+		config.CacheSize = DefaultAPIKeyConfig.CacheSize
+	}
+
+	cache := newLookupCache(config.CacheSize, config.CacheTTL)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := req.Context()
+
+			key := strings.TrimSpace(req.Header.Get(config.Header))
+			if key == "" && config.QueryParam != "" {
+				key = c.QueryParam(config.QueryParam)
+			}
+			if key == "" {
+				return WriteProblem(c, http.StatusUnauthorized, NewProblem(c, http.StatusUnauthorized, "api key required"))
+			}
+
+			hash := HashAPIKey(key)
+			val, err := cache.get(ctx, hash, func(ctx context.Context) (interface{}, error) {
+				return config.Store.Lookup(ctx, hash)
+			})
+			if err != nil {
+				return err
+			}
+			k := val.(*APIKeyRecord)
+
+			fields := logrus.Fields{
+				"route":  c.Path(),
+				"method": req.Method,
+			}
+			if k == nil {
+				logx.WithSeverityWarn(ctx).WithFields(fields).Warn("api key denied: unknown key")
+				return WriteProblem(c, http.StatusUnauthorized, NewProblem(c, http.StatusUnauthorized, "invalid api key"))
+			}
+			if k.Expired(time.Now()) {
+				fields["api_key_id"] = k.ID
+				fields["owner"] = k.Owner
+				logx.WithSeverityWarn(ctx).WithFields(fields).Warn("api key denied: expired")
+				return WriteProblem(c, http.StatusUnauthorized, NewProblem(c, http.StatusUnauthorized, "api key expired"))
+			}
+
+			ctx = contextx.SetPrincipal(ctx, &contextx.Principal{
+				Subject: k.Owner,
+				Issuer:  APIKeyIssuer,
+				Scopes:  k.Scopes,
+				Claims:  map[string]interface{}{"api_key_id": k.ID},
+			})
+			c.SetRequest(req.WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
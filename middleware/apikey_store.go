@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// MemoryAPIKeyStore keeps API keys in process memory.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*APIKeyRecord
+}
+
+// NewMemoryAPIKeyStore returns a store holding keys.
+func NewMemoryAPIKeyStore(keys ...*APIKeyRecord) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{keys: make(map[string]*APIKeyRecord, len(keys))}
+	for _, k := range keys {
+		s.keys[k.Hash] = k
+	}
+	return s
+}
+
+// Add stores k, replacing any key with the same hash.
+func (s *MemoryAPIKeyStore) Add(k *APIKeyRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.Hash] = k
+}
+
+// Lookup implements APIKeyStore.
+func (s *MemoryAPIKeyStore) Lookup(ctx context.Context, hash string) (*APIKeyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[hash], nil
+}
+
+// RedisAPIKeyStore keeps API keys in Redis as JSON under prefix+hash.
+type RedisAPIKeyStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisAPIKeyStore returns a store backed by client, e.g. the
+// redis.UniversalClient embedded in a redisx.Client. Prefix defaults to
+// "apikey:".
+func NewRedisAPIKeyStore(client redis.Cmdable, prefix string) *RedisAPIKeyStore {
+	if prefix == "" {
+		prefix = "apikey:"
+	}
+	return &RedisAPIKeyStore{client: client, prefix: prefix}
+}
+
+// Add stores k, expiring it from Redis along with the key.
+func (s *RedisAPIKeyStore) Add(ctx context.Context, k *APIKeyRecord) error {
+	b, err := json.Marshal(k)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var ttl time.Duration
+	if k.ExpiresAt != nil {
+		if ttl = time.Until(*k.ExpiresAt); ttl <= 0 {
+			return nil
+		}
+	}
+	return errors.WithStack(s.client.Set(ctx, s.prefix+k.Hash, b, ttl).Err())
+}
+
+// Lookup implements APIKeyStore.
+func (s *RedisAPIKeyStore) Lookup(ctx context.Context, hash string) (*APIKeyRecord, error) {
+	b, err := s.client.Get(ctx, s.prefix+hash).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	k := new(APIKeyRecord)
+	if err := json.Unmarshal(b, k); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return k, nil
+}
+
+// SQLAPIKey is the gorm model of the api_keys table. Scopes are space
+// separated.
+type SQLAPIKey struct {
+	ID        string `gorm:"primaryKey"`
+	Hash      string `gorm:"uniqueIndex;size:64;not null"`
+	Owner     string `gorm:"not null"`
+	Scopes    string
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+}
+
+// TableName implements gorm's schema.Tabler.
+func (SQLAPIKey) TableName() string {
+	return "api_keys"
+}
+
+// SQLAPIKeyStore reads API keys from a SQL table through gorm.
+type SQLAPIKeyStore struct {
+	db *gorm.DB
+}
+
+// NewSQLAPIKeyStore returns a store reading the SQLAPIKey table of db.
+// Create it with db.AutoMigrate(&SQLAPIKey{}) or an equivalent migration.
+func NewSQLAPIKeyStore(db *gorm.DB) *SQLAPIKeyStore {
+	return &SQLAPIKeyStore{db: db}
+}
+
+// Lookup implements APIKeyStore.
+func (s *SQLAPIKeyStore) Lookup(ctx context.Context, hash string) (*APIKeyRecord, error) {
+	var row SQLAPIKey
+	err := s.db.WithContext(ctx).Where("hash = ?", hash).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &APIKeyRecord{
+		ID:        row.ID,
+		Hash:      row.Hash,
+		Owner:     row.Owner,
+		Scopes:    strings.Fields(row.Scopes),
+		ExpiresAt: row.ExpiresAt,
+	}, nil
+}
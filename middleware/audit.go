@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Audit outcomes.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records who changed what.
+type AuditEvent struct {
+	Time       time.Time         `json:"time"`
+	RequestID  string            `json:"request_id"`
+	Actor      string            `json:"actor"`
+	Issuer     string            `json:"issuer,omitempty"`
+	Method     string            `json:"method"`
+	Route      string            `json:"route"`
+	Path       string            `json:"path"`
+	ResourceID string            `json:"resource_id,omitempty"`
+	Params     map[string]string `json:"params,omitempty"`
+	Status     int               `json:"status"`
+	Outcome    string            `json:"outcome"`
+	Changes    json.RawMessage   `json:"changes,omitempty"`
+	RemoteIP   string            `json:"remote_ip"`
+}
+
+// AuditSink receives audit events.
+type AuditSink interface {
+	Emit(ctx context.Context, event *AuditEvent) error
+}
+
+// AuditSinkFunc adapts a function to AuditSink.
+type AuditSinkFunc func(ctx context.Context, event *AuditEvent) error
+
+// Emit calls f(ctx, event).
+func (f AuditSinkFunc) Emit(ctx context.Context, event *AuditEvent) error {
+	return f(ctx, event)
+}
+
+// LogAuditSink writes events through logx.
+func LogAuditSink() AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, event *AuditEvent) error {
+		logx.WithSeverityInfo(ctx).WithFields(logrus.Fields{
+			"audit": event,
+		}).Info("audit event")
+		return nil
+	})
+}
+
+// KafkaAuditSink produces events to topic, e.g. with a *saramax.Produce.
+func KafkaAuditSink(producer interface {
+	Produce(ctx context.Context, topic string, i interface{}) error
+}, topic string) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, event *AuditEvent) error {
+		return producer.Produce(ctx, topic, event)
+	})
+}
+
+// PubSubAuditSink publishes events to topicID, e.g. with a *pubsubx.Pub.
+func PubSubAuditSink(pub interface {
+	Publish(ctx context.Context, topicID string, i interface{}) error
+}, topicID string) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, event *AuditEvent) error {
+		return pub.Publish(ctx, topicID, event)
+	})
+}
+
+// AuditConfig defines the config for Audit middleware.
+type AuditConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Sink receives the events.
+	// Default is LogAuditSink.
+	Sink AuditSink
+
+	// Methods that are audited.
+	// Default is POST, PUT, PATCH and DELETE.
+	Methods []string
+
+	// Routes restricts auditing to these route templates (c.Path()).
+	// Default audits every route.
+	Routes []string
+
+	// ResourceParam is the path param holding the resource ID.
+	// Default is "id".
+	ResourceParam string
+
+	// RedactFields lists JSON body fields replaced in Changes.
+	// Default, when nil, is the list of DefaultAuditConfig; an empty slice
+	// redacts nothing.
+	RedactFields []string
+
+	// MaxBodySize is the maximum number of request body bytes recorded.
+	// Larger bodies are not recorded. Default is logx.LimitMSG.
+	MaxBodySize int
+}
+
+var (
+	// DefaultAuditConfig is the default Audit middleware config.
+	DefaultAuditConfig = AuditConfig{
+		Skipper:       DefaultSkipper,
+		Methods:       []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		ResourceParam: "id",
+		RedactFields:  []string{"password", "secret", "token", "access_token", "refresh_token"},
+	}
+)
+
+// Audit returns a middleware that emits an audit event for mutations.
+func Audit(sink AuditSink) echo.MiddlewareFunc {
+	config := DefaultAuditConfig
+	config.Sink = sink
+	return AuditWithConfig(config)
+}
+
+// AuditWithConfig returns an Audit middleware with config.
+func AuditWithConfig(config AuditConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultAuditConfig.Skipper
+	}
+	if config.Sink == nil {
+		config.Sink = LogAuditSink()
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = DefaultAuditConfig.Methods
+	}
+	if config.ResourceParam == "" {
+		config.ResourceParam = DefaultAuditConfig.ResourceParam
+	}
+	if config.RedactFields == nil {
+		config.RedactFields = DefaultAuditConfig.RedactFields
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = logx.LimitMSG
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Skipper(c) || !containsFold(config.Methods, req.Method) {
+				return next(c)
+			}
+			if len(config.Routes) > 0 && !contains(config.Routes, c.Path()) {
+				return next(c)
+			}
+
+			changes := config.captureBody(req)
+
+			err := next(c)
+			status := responseStatus(c, err)
+
+			ctx := c.Request().Context()
+			event := &AuditEvent{
+				Time:       time.Now(),
+				RequestID:  contextx.GetID(ctx),
+				Actor:      "anonymous",
+				Method:     req.Method,
+				Route:      c.Path(),
+				Path:       req.URL.Path,
+				ResourceID: c.Param(config.ResourceParam),
+				Params:     pathParams(c),
+				Status:     status,
+				Outcome:    AuditOutcomeSuccess,
+				Changes:    changes,
+				RemoteIP:   ClientIP(c),
+			}
+			if p, ok := contextx.GetPrincipal(ctx); ok {
+				event.Actor = p.Subject
+				event.Issuer = p.Issuer
+			}
+			if status >= http.StatusBadRequest {
+				event.Outcome = AuditOutcomeFailure
+			}
+
+			if serr := config.Sink.Emit(ctx, event); serr != nil {
+				logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+					"audit": event,
+					"error": serr,
+				}).Error("audit emit error")
+			}
+
+			return err
+		}
+	}
+}
+
+// captureBody returns the redacted JSON request body, leaving req.Body
+// readable. Bodies that are too large or not JSON are not recorded.
+func (config AuditConfig) captureBody(req *http.Request) json.RawMessage {
+	if req.Body == nil {
+		return nil
+	}
+
+	head, _ := ioutil.ReadAll(io.LimitReader(req.Body, int64(config.MaxBodySize)+1))
+	req.Body = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(head), req.Body),
+		Closer: req.Body,
+	}
+	if len(head) == 0 || len(head) > config.MaxBodySize {
+		return nil
+	}
+
+	var v interface{}
+	if json.Unmarshal(head, &v) != nil {
+		return nil
+	}
+	b, err := json.Marshal(redactJSON(v, config.RedactFields))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func pathParams(c echo.Context) map[string]string {
+	names := c.ParamNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		params[name] = c.Param(name)
+	}
+	return params
+}
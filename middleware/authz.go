@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// AuthzPolicy decides whether principal may access the route.
+type AuthzPolicy func(c echo.Context, principal *contextx.Principal) bool
+
+// RequireScopes allows principals holding every one of scopes.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return authorize("scopes", scopes, func(c echo.Context, p *contextx.Principal) bool {
+		for _, s := range scopes {
+			if !contains(p.Scopes, s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireRoles allows principals holding any one of roles.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return authorize("roles", roles, func(c echo.Context, p *contextx.Principal) bool {
+		for _, r := range roles {
+			if contains(p.Roles, r) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePolicy allows principals accepted by policy; name identifies the
+// policy in denial logs.
+func RequirePolicy(name string, policy AuthzPolicy) echo.MiddlewareFunc {
+	return authorize("policy", []string{name}, policy)
+}
+
+func authorize(kind string, required []string, policy AuthzPolicy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			principal, ok := contextx.GetPrincipal(ctx)
+			if !ok {
+				logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+					"route":  c.Path(),
+					"method": c.Request().Method,
+				}).Warn("authorization denied: unauthenticated")
+				return WriteProblem(c, http.StatusUnauthorized, NewProblem(c, http.StatusUnauthorized, "authentication required"))
+			}
+
+			if !policy(c, principal) {
+				logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+					"route":    c.Path(),
+					"method":   c.Request().Method,
+					"subject":  principal.Subject,
+					"required": required,
+					"kind":     kind,
+				}).Warn("authorization denied")
+				return WriteProblem(c, http.StatusForbidden, NewProblem(c, http.StatusForbidden, "insufficient "+kind))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// Bind error codes.
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeValidationFailed = "validation_failed"
+	ErrCodeBodyTooLarge     = "request_entity_too_large"
+)
+
+// ErrBodyTooLarge is returned by reads past the BodyLimit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// FieldError describes one field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Validator implements echo.Validator with struct tag validation. Fields are
+// reported by their json, query or param tag names.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// NewValidator returns a Validator.
+func NewValidator() *Validator {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "query", "param", "form"} {
+			name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return f.Name
+	})
+
+	return &Validator{validate: v}
+}
+
+// Engine returns the underlying validator to register custom rules.
+func (v *Validator) Engine() *validator.Validate {
+	return v.validate
+}
+
+// Validate implements echo.Validator. It returns an *Error with status 422
+// and the failed fields as details.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return NewError(http.StatusBadRequest, ErrCodeInvalidRequest, "invalid request").Wrap(err)
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+
+	return NewError(http.StatusUnprocessableEntity, ErrCodeValidationFailed, "request validation failed").
+		WithDetails(fields).
+		Wrap(err)
+}
+
+// fieldPath drops the top-level struct name from a validator namespace.
+func fieldPath(ns string) string {
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must have length %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fe.Param())
+	case "email":
+		return "must be a valid email"
+	}
+	return fmt.Sprintf("failed on the '%s' rule", fe.Tag())
+}
+
+// Bind binds path params, query params and body into i and validates it
+// with the echo instance's Validator, see NewValidator.
+func Bind(c echo.Context, i interface{}) error {
+	b := new(echo.DefaultBinder)
+	err := b.BindPathParams(c, i)
+	if err == nil {
+		err = b.BindQueryParams(c, i)
+	}
+	if err == nil {
+		err = b.BindBody(c, i)
+	}
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return NewError(http.StatusRequestEntityTooLarge, ErrCodeBodyTooLarge, ErrBodyTooLarge.Error()).Wrap(err)
+		}
+		return NewError(http.StatusBadRequest, ErrCodeInvalidRequest, "malformed request").Wrap(err)
+	}
+
+	if c.Echo().Validator == nil {
+		return nil
+	}
+	return c.Validate(i)
+}
+
+// BodyLimit returns a middleware rejecting request bodies larger than limit
+// bytes with 413, before any of the body is read.
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if DefaultSkipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			if req.ContentLength > limit {
+				return NewError(http.StatusRequestEntityTooLarge, ErrCodeBodyTooLarge, ErrBodyTooLarge.Error())
+			}
+			if req.Body != nil {
+				req.Body = &limitedReadCloser{ReadCloser: req.Body, remaining: limit}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// limitedReadCloser fails with ErrBodyTooLarge once more than remaining
+// bytes are read, for bodies without a trustworthy Content-Length.
+type limitedReadCloser struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
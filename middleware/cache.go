@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tOnkowzl/libs/contextx"
+	"golang.org/x/sync/singleflight"
+)
+
+// lookupTimeout bounds a store lookup shared by concurrent requests.
+const lookupTimeout = 10 * time.Second
+
+// lookupCache is a size-bounded LRU of store answers kept for a TTL.
+// Concurrent misses of a key share one load, run detached from the request
+// that started it so its cancellation does not fail the others. Errors are
+// not cached.
+type lookupCache struct {
+	size  int
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type lookupEntry struct {
+	key     string
+	val     interface{}
+	expires time.Time
+}
+
+func newLookupCache(size int, ttl time.Duration) *lookupCache {
+	return &lookupCache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value of key, or calls load and caches its result.
+func (lc *lookupCache) get(ctx context.Context, key string, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if val, ok := lc.cached(key); ok {
+		return val, nil
+	}
+
+	id := contextx.GetID(ctx)
+	ch := lc.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(contextx.SetID(context.Background(), id), lookupTimeout)
+		defer cancel()
+
+		val, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lc.add(key, val)
+		return val, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		return res.Val, res.Err
+	}
+}
+
+func (lc *lookupCache) cached(key string) (interface{}, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	el, ok := lc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lookupEntry)
+	if time.Now().After(e.expires) {
+		lc.ll.Remove(el)
+		delete(lc.entries, key)
+		return nil, false
+	}
+	lc.ll.MoveToFront(el)
+	return e.val, true
+}
+
+func (lc *lookupCache) add(key string, val interface{}) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	expires := time.Now().Add(lc.ttl)
+	if el, ok := lc.entries[key]; ok {
+		e := el.Value.(*lookupEntry)
+		e.val, e.expires = val, expires
+		lc.ll.MoveToFront(el)
+		return
+	}
+
+	lc.entries[key] = lc.ll.PushFront(&lookupEntry{key: key, val: val, expires: expires})
+	if lc.ll.Len() > lc.size {
+		oldest := lc.ll.Back()
+		lc.ll.Remove(oldest)
+		delete(lc.entries, oldest.Value.(*lookupEntry).key)
+	}
+}
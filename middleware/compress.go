@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+// Compression encodings.
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// CompressConfig defines the config for Compress middleware.
+type CompressConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// GzipLevel is the gzip compression level.
+	// Default is gzip.DefaultCompression.
+	GzipLevel int
+
+	// BrotliLevel is the brotli compression level.
+	// Default is 5.
+	BrotliLevel int
+
+	// MinLength is the smallest body that is compressed.
+	// Default is 1024 bytes.
+	MinLength int
+
+	// ContentTypes lists the content type prefixes that are compressed.
+	ContentTypes []string
+}
+
+var (
+	// DefaultCompressConfig is the default Compress middleware config.
+	DefaultCompressConfig = CompressConfig{
+		Skipper:     DefaultSkipper,
+		GzipLevel:   gzip.DefaultCompression,
+		BrotliLevel: 5,
+		MinLength:   1024,
+		ContentTypes: []string{
+			"text/",
+			echo.MIMEApplicationJSON,
+			echo.MIMEApplicationXML,
+			echo.MIMEApplicationJavaScript,
+			MIMEApplicationProblemJSON,
+			"image/svg+xml",
+		},
+	}
+)
+
+// Compress returns a gzip and brotli compression middleware.
+//
+// Register it before Logger so Logger, wrapping the writer further in,
+// still logs the uncompressed body.
+func Compress() echo.MiddlewareFunc {
+	return CompressWithConfig(DefaultCompressConfig)
+}
+
+// CompressWithConfig returns a Compress middleware with config.
+func CompressWithConfig(config CompressConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultCompressConfig.Skipper
+	}
+	if config.GzipLevel == 0 {
+		config.GzipLevel = DefaultCompressConfig.GzipLevel
+	}
+	if config.BrotliLevel == 0 {
+		config.BrotliLevel = DefaultCompressConfig.BrotliLevel
+	}
+	if config.MinLength == 0 {
+		config.MinLength = DefaultCompressConfig.MinLength
+	}
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = DefaultCompressConfig.ContentTypes
+	}
+
+	gzipPool := sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, config.GzipLevel)
+		return w
+	}}
+	brotliPool := sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, config.BrotliLevel)
+	}}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+			encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoding == "" || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+
+			w := &compressWriter{
+				ResponseWriter: res.Writer,
+				config:         &config,
+				encoding:       encoding,
+				code:           http.StatusOK,
+			}
+			switch encoding {
+			case EncodingBrotli:
+				w.newEncoder = func(dst io.Writer) encoder {
+					bw := brotliPool.Get().(*brotli.Writer)
+					bw.Reset(dst)
+					return bw
+				}
+				w.release = func(e encoder) { brotliPool.Put(e) }
+			default:
+				w.newEncoder = func(dst io.Writer) encoder {
+					gw := gzipPool.Get().(*gzip.Writer)
+					gw.Reset(dst)
+					return gw
+				}
+				w.release = func(e encoder) { gzipPool.Put(e) }
+			}
+
+			orig := res.Writer
+			res.Writer = w
+			defer func() { res.Writer = orig }()
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			return w.close()
+		}
+	}
+}
+
+// negotiateEncoding picks brotli or gzip from an Accept-Encoding header.
+func negotiateEncoding(accept string) string {
+	var gzipOK, brotliOK bool
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		ok := true
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				q, err := strconv.ParseFloat(f[2:], 64)
+				ok = err == nil && q > 0
+			}
+		}
+		switch name {
+		case EncodingBrotli:
+			brotliOK = ok
+		case EncodingGzip, "*":
+			gzipOK = gzipOK || ok
+		}
+	}
+
+	switch {
+	case brotliOK:
+		return EncodingBrotli
+	case gzipOK:
+		return EncodingGzip
+	}
+	return ""
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter buffers up to MinLength bytes before deciding whether to
+// compress, so the decision sees the final headers and enough of the body.
+type compressWriter struct {
+	http.ResponseWriter
+	config     *CompressConfig
+	encoding   string
+	newEncoder func(dst io.Writer) encoder
+	release    func(e encoder)
+
+	code    int
+	buf     bytes.Buffer
+	decided bool
+	enc     encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	n, _ := w.buf.Write(b)
+	if w.buf.Len() >= w.config.MinLength {
+		return n, w.decide(true)
+	}
+	return n, nil
+}
+
+// decide writes the header and the buffered body, compressed when large is
+// set and the response qualifies.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+
+	h := w.ResponseWriter.Header()
+	if large && w.compressible(h) {
+		h.Del(echo.HeaderContentLength)
+		h.Set(echo.HeaderContentEncoding, w.encoding)
+		// the strong tag was computed for the identity body
+		if etag := h.Get(HeaderETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set(HeaderETag, "W/"+etag)
+		}
+		w.enc = w.newEncoder(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) compressible(h http.Header) bool {
+	if h.Get(echo.HeaderContentEncoding) != "" {
+		return false
+	}
+	if w.code < http.StatusOK || w.code == http.StatusNoContent || w.code == http.StatusNotModified {
+		return false
+	}
+
+	ct := strings.ToLower(h.Get(echo.HeaderContentType))
+	for _, t := range w.config.ContentTypes {
+		if strings.HasPrefix(ct, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		// streaming responses are compressed regardless of size
+		w.decide(true)
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// a hijacked connection is written directly by the handler
+	w.decided = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// close writes whatever is still buffered and finishes the encoder.
+func (w *compressWriter) close() error {
+	var err error
+	if !w.decided {
+		err = w.decide(false)
+	}
+	if w.enc != nil {
+		if cerr := w.enc.Close(); err == nil {
+			err = cerr
+		}
+		w.release(w.enc)
+		w.enc = nil
+	}
+	return err
+}
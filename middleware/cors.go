@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CORSConfig defines the config for CORS middleware. It can be loaded from
+// viper, e.g. viperx.UnmarshalKey(ctx, "http.cors", &config).
+type CORSConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper `mapstructure:"-"`
+
+	// AllowOrigins lists allowed origins. "*" allows any origin and
+	// "https://*.example.com" allows any subdomain of example.com.
+	// Default is "*".
+	AllowOrigins []string `mapstructure:"allow_origins"`
+
+	// AllowMethods lists methods allowed in preflight responses.
+	AllowMethods []string `mapstructure:"allow_methods"`
+
+	// AllowHeaders lists request headers allowed in preflight responses.
+	// Default reflects the headers the preflight asks for.
+	AllowHeaders []string `mapstructure:"allow_headers"`
+
+	// AllowCredentials allows cookies and authorization headers. It cannot
+	// be combined with the "*" origin; list the trusted origins instead.
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+
+	// ExposeHeaders lists response headers readable by the client.
+	ExposeHeaders []string `mapstructure:"expose_headers"`
+
+	// MaxAge is how long a preflight response may be cached.
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+var (
+	// DefaultCORSConfig is the default CORS middleware config.
+	DefaultCORSConfig = CORSConfig{
+		Skipper:      DefaultSkipper,
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch,
+			http.MethodPost, http.MethodDelete,
+		},
+	}
+)
+
+// CORS returns a Cross-Origin Resource Sharing middleware allowing any
+// origin.
+func CORS() echo.MiddlewareFunc {
+	return CORSWithConfig(DefaultCORSConfig)
+}
+
+// CORSWithConfig returns a CORS middleware with config.
+func CORSWithConfig(config CORSConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultCORSConfig.Skipper
+	}
+	if len(config.AllowOrigins) == 0 {
+		config.AllowOrigins = DefaultCORSConfig.AllowOrigins
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = DefaultCORSConfig.AllowMethods
+	}
+	if config.AllowCredentials && contains(config.AllowOrigins, "*") {
+		// any site could make credentialed reads
+		panic("echo: cors middleware cannot allow credentials for any origin")
+	}
+
+	allowMethods := strings.Join(config.AllowMethods, ",")
+	allowHeaders := strings.Join(config.AllowHeaders, ",")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ",")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			h := c.Response().Header()
+			origin := req.Header.Get(echo.HeaderOrigin)
+			preflight := req.Method == http.MethodOptions && req.Header.Get(echo.HeaderAccessControlRequestMethod) != ""
+
+			h.Add(echo.HeaderVary, echo.HeaderOrigin)
+			if preflight {
+				h.Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+				h.Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+			}
+
+			allowOrigin := config.allowOrigin(origin)
+			if origin == "" || allowOrigin == "" {
+				if preflight {
+					return c.NoContent(http.StatusNoContent)
+				}
+				return next(c)
+			}
+
+			h.Set(echo.HeaderAccessControlAllowOrigin, allowOrigin)
+			if config.AllowCredentials {
+				h.Set(echo.HeaderAccessControlAllowCredentials, "true")
+			}
+
+			if !preflight {
+				if exposeHeaders != "" {
+					h.Set(echo.HeaderAccessControlExposeHeaders, exposeHeaders)
+				}
+				return next(c)
+			}
+
+			h.Set(echo.HeaderAccessControlAllowMethods, allowMethods)
+			if allowHeaders != "" {
+				h.Set(echo.HeaderAccessControlAllowHeaders, allowHeaders)
+			} else if reqHeaders := req.Header.Get(echo.HeaderAccessControlRequestHeaders); reqHeaders != "" {
+				h.Set(echo.HeaderAccessControlAllowHeaders, reqHeaders)
+			}
+			if config.MaxAge > 0 {
+				h.Set(echo.HeaderAccessControlMaxAge, maxAge)
+			}
+			return c.NoContent(http.StatusNoContent)
+		}
+	}
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" when origin is not allowed.
+func (config CORSConfig) allowOrigin(origin string) string {
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			return "*"
+		}
+		if matchOrigin(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchOrigin matches origin against pattern, where "*." in pattern stands
+// for one or more subdomain labels.
+func matchOrigin(pattern, origin string) bool {
+	if strings.EqualFold(pattern, origin) {
+		return true
+	}
+
+	i := strings.Index(pattern, "*.")
+	if i < 0 {
+		return false
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	if !strings.EqualFold(origin[:len(prefix)], prefix) || !strings.EqualFold(origin[len(origin)-len(suffix):], suffix) {
+		return false
+	}
+
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:") && !strings.HasPrefix(sub, ".")
+}
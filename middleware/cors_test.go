@@ -0,0 +1,77 @@
+package middleware
+
+import "testing"
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "http://api.example.com", false},
+		{"https://*.example.com", "https://api.example.com.evil.io", false},
+		{"https://*.example.com", "https://evil.io/x.example.com", false},
+		{"https://*.example.com", "https://evil.io:1.example.com", false},
+		{"https://*.example.com:8443", "https://api.example.com:8443", true},
+		{"https://*.example.com:8443", "https://api.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+				t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSAllowOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CORSConfig
+		origin string
+		want   string
+	}{
+		{
+			name:   "any origin",
+			config: CORSConfig{AllowOrigins: []string{"*"}},
+			origin: "https://example.com",
+			want:   "*",
+		},
+		{
+			name:   "listed origin is echoed",
+			config: CORSConfig{AllowOrigins: []string{"https://*.example.com"}, AllowCredentials: true},
+			origin: "https://api.example.com",
+			want:   "https://api.example.com",
+		},
+		{
+			name:   "unlisted origin",
+			config: CORSConfig{AllowOrigins: []string{"https://*.example.com"}},
+			origin: "https://evil.io",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.allowOrigin(tt.origin); got != tt.want {
+				t.Errorf("allowOrigin(%q) = %q, want %q", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSWithConfigRejectsCredentialsForAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("CORSWithConfig did not panic")
+		}
+	}()
+	CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
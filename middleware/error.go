@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Error is an application error rendered by ErrorHandler.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+// NewError returns an application error.
+func NewError(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the wrapped cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *Error) WithDetails(details interface{}) *Error {
+	out := *e
+	out.Details = details
+	return &out
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	out := *e
+	out.Err = err
+	return &out
+}
+
+// ErrorHandlerConfig defines the config for ErrorHandler.
+type ErrorHandlerConfig struct {
+	// Production hides messages, details and causes of 5xx errors.
+	Production bool
+
+	// TypeBaseURL prefixes the error code to build the problem type URI.
+	// Default leaves the type as about:blank.
+	TypeBaseURL string
+}
+
+var (
+	// DefaultErrorHandlerConfig is the default ErrorHandler config.
+	DefaultErrorHandlerConfig = ErrorHandlerConfig{
+		Production: true,
+	}
+)
+
+// ErrorHandler returns an echo.HTTPErrorHandler rendering
+// application/problem+json.
+func ErrorHandler() echo.HTTPErrorHandler {
+	return ErrorHandlerWithConfig(DefaultErrorHandlerConfig)
+}
+
+// ErrorHandlerWithConfig returns an ErrorHandler with config.
+func ErrorHandlerWithConfig(config ErrorHandlerConfig) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		ctx := c.Request().Context()
+		appErr := toError(err)
+
+		fields := logrus.Fields{
+			"status": appErr.Status,
+			"code":   appErr.Code,
+			"route":  c.Path(),
+			"method": c.Request().Method,
+			"error":  fmt.Sprintf("%+v", err),
+		}
+		switch {
+		case appErr.Status >= http.StatusInternalServerError:
+			logx.WithSeverityError(ctx).WithFields(fields).Error("echo error handler")
+		case appErr.Status >= http.StatusBadRequest:
+			logx.WithSeverityWarn(ctx).WithFields(fields).Warn("echo error handler")
+		default:
+			logx.WithSeverityInfo(ctx).WithFields(fields).Info("echo error handler")
+		}
+
+		if c.Response().Committed {
+			return
+		}
+
+		p := NewProblem(c, appErr.Status, appErr.Message)
+		p.Code = appErr.Code
+		p.Details = appErr.Details
+		if config.TypeBaseURL != "" && appErr.Code != "" {
+			p.Type = config.TypeBaseURL + appErr.Code
+		}
+		if appErr.Status >= http.StatusInternalServerError {
+			if config.Production {
+				p.Detail = http.StatusText(appErr.Status)
+				p.Details = nil
+			} else if appErr.Err != nil {
+				p.Detail = appErr.Message + ": " + appErr.Err.Error()
+			}
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(appErr.Status)
+		} else {
+			err = WriteProblem(c, appErr.Status, p)
+		}
+		if err != nil {
+			logx.WithSeverityError(ctx).WithField("error", err).Error("echo error handler write error")
+		}
+	}
+}
+
+// toError converts err to an application error, keeping err as the cause.
+func toError(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		if appErr.Status < 100 || appErr.Status > 599 {
+			// net/http panics on an invalid status; copy so the caller's
+			// error is not modified
+			e := *appErr
+			e.Status = http.StatusInternalServerError
+			return &e
+		}
+		return appErr
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return &Error{
+			Status:  he.Code,
+			Code:    httpErrorCode(he.Code),
+			Message: fmt.Sprint(he.Message),
+			Err:     he.Internal,
+		}
+	}
+
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    httpErrorCode(http.StatusInternalServerError),
+		Message: http.StatusText(http.StatusInternalServerError),
+		Err:     err,
+	}
+}
+
+// httpErrorCode derives a code such as "not_found" from a status.
+func httpErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+
+	code := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		switch ch := text[i]; {
+		case ch >= 'A' && ch <= 'Z':
+			code = append(code, ch+'a'-'A')
+		case ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9':
+			code = append(code, ch)
+		case len(code) > 0 && code[len(code)-1] != '_':
+			code = append(code, '_')
+		}
+	}
+	return string(code)
+}
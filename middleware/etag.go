@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ETag headers.
+const (
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// ETagConfig defines the config for ETag middleware.
+type ETagConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Weak generates weak validators (W/"...").
+	Weak bool
+
+	// MaxSize is the largest body buffered for hashing; larger responses
+	// are streamed without an ETag. Default is 1MB.
+	MaxSize int
+}
+
+var (
+	// DefaultETagConfig is the default ETag middleware config.
+	DefaultETagConfig = ETagConfig{
+		Skipper: DefaultSkipper,
+		MaxSize: 1 << 20,
+	}
+)
+
+// ETag returns a middleware that hashes GET and HEAD responses into an ETag
+// and answers a matching If-None-Match with 304 Not Modified.
+//
+// Register it after Compress and Logger, e.g.
+//
+//	e.Use(middleware.Compress(), middleware.Logger(), middleware.ETag())
+//
+// so the tag is computed over the uncompressed body and Logger, wrapping the
+// writer further out, logs the 304 and its empty body as the client gets
+// them. Compress marks the tag weak when it encodes the body, since the
+// encoded bytes differ from the tagged ones.
+func ETag() echo.MiddlewareFunc {
+	return ETagWithConfig(DefaultETagConfig)
+}
+
+// ETagWithConfig returns an ETag middleware with config.
+func ETagWithConfig(config ETagConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultETagConfig.Skipper
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = DefaultETagConfig.MaxSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Skipper(c) || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			res := c.Response()
+			w := &etagWriter{ResponseWriter: res.Writer, max: config.MaxSize, code: http.StatusOK}
+
+			orig := res.Writer
+			res.Writer = w
+			defer func() { res.Writer = orig }()
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+			if w.streaming {
+				return nil
+			}
+
+			h := w.Header()
+			if w.code != http.StatusOK || h.Get(HeaderETag) != "" {
+				return w.flush()
+			}
+
+			// a strong tag identifies one representation, so a body encoded
+			// further in gets its own tag; Compress weakens tags it encodes
+			sum := sha1.Sum(w.buf.Bytes())
+			opaque := hex.EncodeToString(sum[:])
+			if enc := h.Get(echo.HeaderContentEncoding); enc != "" {
+				opaque += "-" + enc
+			}
+			tag := `"` + opaque + `"`
+			if config.Weak {
+				tag = "W/" + tag
+			}
+			h.Set(HeaderETag, tag)
+
+			if etagMatch(req.Header.Get(HeaderIfNoneMatch), tag) {
+				h.Del(echo.HeaderContentType)
+				h.Del(echo.HeaderContentLength)
+				w.ResponseWriter.WriteHeader(http.StatusNotModified)
+				res.Status = http.StatusNotModified
+				return nil
+			}
+			return w.flush()
+		}
+	}
+}
+
+// etagMatch reports whether the If-None-Match header matches tag, using
+// weak comparison as RFC 7232 requires for If-None-Match.
+func etagMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter buffers the response until it ends or grows past max, at which
+// point it switches to streaming.
+type etagWriter struct {
+	http.ResponseWriter
+	max       int
+	code      int
+	buf       bytes.Buffer
+	streaming bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.buf.Len()+len(b) > w.max {
+		if err := w.stream(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+func (w *etagWriter) Flush() {
+	if !w.streaming {
+		w.stream()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *etagWriter) stream() error {
+	w.streaming = true
+	return w.flush()
+}
+
+// flush writes the deferred header and the buffered body.
+func (w *etagWriter) flush() error {
+	w.ResponseWriter.WriteHeader(w.code)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+	"github.com/tOnkowzl/libs/viperx"
+)
+
+// FeatureFlag is the rule of one flag. A map[string]FeatureFlag can be
+// loaded from viper with NewFeatureFlagsFromViper.
+type FeatureFlag struct {
+	// Enabled turns the flag on for every request.
+	Enabled bool `mapstructure:"enabled"`
+
+	// Subjects turns the flag on for these authenticated subjects.
+	Subjects []string `mapstructure:"subjects"`
+
+	// Tenants turns the flag on for these tenants.
+	Tenants []string `mapstructure:"tenants"`
+
+	// Headers turns the flag on for requests carrying one of these header
+	// values, keyed by header name.
+	Headers map[string]string `mapstructure:"headers"`
+
+	// Percentage turns the flag on for this share, 0 to 100, of subjects,
+	// or of ClientIPs for anonymous requests. A caller keeps its answer
+	// while the percentage does not drop.
+	Percentage float64 `mapstructure:"percentage"`
+}
+
+// FeatureFlags evaluates flags per request. The flags can be swapped at
+// runtime with Update, or follow a viper key with NewFeatureFlagsFromViper:
+//
+//	flags, err := middleware.NewFeatureFlagsFromViper(ctx, "features")
+//	e.GET("/v2/orders", h, flags.Gate("orders_v2"))
+type FeatureFlags struct {
+	flags atomic.Value
+}
+
+// NewFeatureFlags returns FeatureFlags evaluating flags.
+func NewFeatureFlags(flags map[string]FeatureFlag) *FeatureFlags {
+	f := &FeatureFlags{}
+	f.Update(flags)
+	return f
+}
+
+// NewFeatureFlagsFromViper returns FeatureFlags evaluating the flags at
+// viper key, reloaded whenever the config file changes. A reload that fails
+// to unmarshal keeps the previous flags.
+func NewFeatureFlagsFromViper(ctx context.Context, key string) (*FeatureFlags, error) {
+	var flags map[string]FeatureFlag
+	if err := viperx.UnmarshalKey(ctx, key, &flags); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f := NewFeatureFlags(flags)
+
+	viperx.Watch(func() {
+		var flags map[string]FeatureFlag
+		if err := viperx.UnmarshalKey(context.Background(), key, &flags); err != nil {
+			logx.WithSeverityError(context.Background()).WithFields(logrus.Fields{
+				"key":   key,
+				"error": err,
+			}).Error("feature flags reload error")
+			return
+		}
+		f.Update(flags)
+	})
+	return f, nil
+}
+
+// Update replaces all flags. Names are case-insensitive, as viper lowercases
+// map keys.
+func (f *FeatureFlags) Update(flags map[string]FeatureFlag) {
+	lower := make(map[string]FeatureFlag, len(flags))
+	for name, flag := range flags {
+		lower[strings.ToLower(name)] = flag
+	}
+	f.flags.Store(lower)
+}
+
+// Enabled reports whether flag name is on for the request. Unknown flags
+// are off.
+func (f *FeatureFlags) Enabled(c echo.Context, name string) bool {
+	name = strings.ToLower(name)
+	flag, ok := f.flags.Load().(map[string]FeatureFlag)[name]
+	if !ok {
+		return false
+	}
+	if flag.Enabled {
+		return true
+	}
+
+	ctx := c.Request().Context()
+	subject := contextx.GetSubject(ctx)
+	if subject != "" && contains(flag.Subjects, subject) {
+		return true
+	}
+	if tenant := contextx.GetTenant(ctx); tenant != "" && contains(flag.Tenants, tenant) {
+		return true
+	}
+	for k, v := range flag.Headers {
+		if got := c.Request().Header.Get(k); got != "" && got == v {
+			return true
+		}
+	}
+
+	if flag.Percentage > 0 {
+		caller := subject
+		if caller == "" {
+			caller = ClientIP(c)
+		}
+		return featureBucket(name, caller) < flag.Percentage
+	}
+	return false
+}
+
+// Gate returns a middleware hiding the route, with 404 Not Found, unless
+// flag name is on for the request.
+func (f *FeatureFlags) Gate(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !f.Enabled(c, name) {
+				return echo.ErrNotFound
+			}
+			return next(c)
+		}
+	}
+}
+
+// featureBucket places caller in [0, 100) for flag, stable across calls and
+// independent between flags.
+func featureBucket(flag, caller string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{0})
+	h.Write([]byte(caller))
+	return float64(h.Sum32()%10000) / 100
+}
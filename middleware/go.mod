@@ -3,9 +3,22 @@ module github.com/tOnkowzl/libs/middleware
 go 1.16
 
 require (
+	github.com/andybalholm/brotli v1.0.3
+	github.com/go-playground/validator/v10 v10.6.1
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/golang-jwt/jwt/v4 v4.1.0
 	github.com/google/uuid v1.2.0
 	github.com/labstack/echo/v4 v4.2.2
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.10.0
 	github.com/sirupsen/logrus v1.8.1
-	github.com/tOnkowzl/libs/contextx v0.0.4
-	github.com/tOnkowzl/libs/logx v0.0.28
+	github.com/tOnkowzl/libs/contextx v0.0.5
+	github.com/tOnkowzl/libs/httpx v0.1.0
+	github.com/tOnkowzl/libs/logx v0.0.29
+	github.com/tOnkowzl/libs/viperx v0.1.0
+	go.opentelemetry.io/contrib/propagators/b3 v1.0.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gorm.io/gorm v1.21.9
 )
@@ -0,0 +1,293 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Health check paths.
+const (
+	LivezPath  = "/livez"
+	ReadyzPath = "/readyz"
+)
+
+// Health check statuses.
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthChecker checks a single dependency.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckerFunc adapts a function to HealthChecker.
+type HealthCheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f HealthCheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthCheck is a named checker registered on a HealthRegistry.
+type HealthCheck struct {
+	Name    string
+	Checker HealthChecker
+
+	// Timeout bounds a single run of Checker.
+	// Default is HealthConfig.Timeout.
+	Timeout time.Duration
+
+	// Liveness includes the check in /livez as well as /readyz. Only
+	// checks whose failure requires a restart should set it.
+	Liveness bool
+}
+
+// HealthConfig defines the config for a HealthRegistry.
+type HealthConfig struct {
+	// Timeout is the default per-check timeout.
+	// Default is 2 seconds.
+	Timeout time.Duration
+
+	// CacheTTL is how long a check result is reused.
+	// Default is 1 second.
+	CacheTTL time.Duration
+}
+
+var (
+	// DefaultHealthConfig is the default HealthRegistry config.
+	DefaultHealthConfig = HealthConfig{
+		Timeout:  2 * time.Second,
+		CacheTTL: time.Second,
+	}
+)
+
+// HealthComponent is the result of one check.
+type HealthComponent struct {
+	Status  string    `json:"status"`
+	Latency string    `json:"latency"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked_at"`
+}
+
+// HealthReport is the body served by the health endpoints.
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]HealthComponent `json:"components,omitempty"`
+}
+
+// HealthRegistry runs registered checks for the liveness and readiness
+// endpoints.
+type HealthRegistry struct {
+	config HealthConfig
+
+	mu       sync.RWMutex
+	checks   []*healthEntry
+	draining bool
+}
+
+type healthEntry struct {
+	HealthCheck
+
+	mu     sync.Mutex
+	result HealthComponent
+}
+
+// NewHealthRegistry returns an empty registry.
+func NewHealthRegistry(config HealthConfig) *HealthRegistry {
+	// Defaults
+	if config.Timeout == 0 {
+		config.Timeout = DefaultHealthConfig.Timeout
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultHealthConfig.CacheTTL
+	}
+
+	return &HealthRegistry{config: config}
+}
+
+// Register adds a check.
+func (h *HealthRegistry) Register(check HealthCheck) {
+	if check.Timeout == 0 {
+		check.Timeout = h.config.Timeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, &healthEntry{HealthCheck: check})
+}
+
+// SetReady marks the service ready or not. A service that is not ready
+// fails /readyz regardless of its checks, e.g. while draining for shutdown.
+func (h *HealthRegistry) SetReady(ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = !ready
+}
+
+// Mount serves LivezPath and ReadyzPath on e.
+func (h *HealthRegistry) Mount(e *echo.Echo) {
+	e.GET(LivezPath, h.LivezHandler())
+	e.GET(ReadyzPath, h.ReadyzHandler())
+}
+
+// LivezHandler serves the liveness report.
+func (h *HealthRegistry) LivezHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return h.serve(c, true)
+	}
+}
+
+// ReadyzHandler serves the readiness report.
+func (h *HealthRegistry) ReadyzHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return h.serve(c, false)
+	}
+}
+
+func (h *HealthRegistry) serve(c echo.Context, liveness bool) error {
+	report := h.Report(c.Request().Context(), liveness)
+	if report.Status != HealthStatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Report runs the liveness or readiness checks concurrently and collects
+// their results.
+func (h *HealthRegistry) Report(ctx context.Context, liveness bool) HealthReport {
+	h.mu.RLock()
+	checks := make([]*healthEntry, 0, len(h.checks))
+	for _, check := range h.checks {
+		if !liveness || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	draining := h.draining && !liveness
+	h.mu.RUnlock()
+
+	if draining {
+		return HealthReport{Status: HealthStatusFail}
+	}
+
+	results := make([]HealthComponent, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check *healthEntry) {
+			defer wg.Done()
+			results[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{
+		Status:     HealthStatusOK,
+		Components: make(map[string]HealthComponent, len(checks)),
+	}
+	for i, check := range checks {
+		if results[i].Status != HealthStatusOK {
+			report.Status = HealthStatusFail
+		}
+		report.Components[check.Name] = results[i]
+	}
+	return report
+}
+
+// run returns the cached result of check, running it when the cache expired.
+// Concurrent callers of an expired check wait for a single run.
+func (h *HealthRegistry) run(ctx context.Context, check *healthEntry) HealthComponent {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	if time.Since(check.result.Checked) < h.config.CacheTTL {
+		return check.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Checker.Check(checkCtx)
+	latency := time.Since(start)
+
+	result := HealthComponent{
+		Status:  HealthStatusOK,
+		Latency: latency.String(),
+		Checked: time.Now(),
+	}
+	if err != nil {
+		result.Status = HealthStatusFail
+		result.Error = err.Error()
+
+		logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+			"check":    check.Name,
+			"error":    err,
+			"duration": latency.String(),
+		}).Warn("health check failed")
+	}
+
+	check.result = result
+	return result
+}
+
+// RedisChecker pings Redis, e.g. through a *redisx.Client.
+func RedisChecker(client interface {
+	Ping(ctx context.Context) *redis.StatusCmd
+}) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		return errors.WithStack(client.Ping(ctx).Err())
+	})
+}
+
+// SQLChecker pings a database, e.g. the *sql.DB of a gorm.DB.
+func SQLChecker(db interface {
+	PingContext(ctx context.Context) error
+}) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		return errors.WithStack(db.PingContext(ctx))
+	})
+}
+
+// KafkaChecker succeeds when any of brokers accepts a TCP connection.
+func KafkaChecker(brokers []string) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		var d net.Dialer
+		err := errors.New("no kafka brokers configured")
+		for _, broker := range brokers {
+			var conn net.Conn
+			conn, err = d.DialContext(ctx, "tcp", broker)
+			if err == nil {
+				return conn.Close()
+			}
+		}
+		return errors.WithStack(err)
+	})
+}
+
+// PubSubTopicChecker succeeds when topic, a *pubsub.Topic, exists.
+func PubSubTopicChecker(topic interface {
+	ID() string
+	Exists(ctx context.Context) (bool, error)
+}) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) error {
+		ok, err := topic.Exists(ctx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !ok {
+			return errors.Errorf("pubsub topic %s does not exist", topic.ID())
+		}
+		return nil
+	})
+}
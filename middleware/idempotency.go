@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// idempotencyStoreTimeout bounds storing the response and releasing the key
+// after the handler returned.
+const idempotencyStoreTimeout = 5 * time.Second
+
+// Idempotency headers.
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// IdempotentResponse is a captured response replayed for duplicate requests.
+type IdempotentResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// RequestHash is the hex SHA-256 of the request body that produced the
+	// response.
+	RequestHash string `json:"request_hash"`
+}
+
+// IdempotencyStore keeps locks and captured responses per key.
+type IdempotencyStore interface {
+	// Lock reserves key for ttl with token and reports whether it was
+	// acquired.
+	Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Unlock releases key if it is still reserved with token.
+	Unlock(ctx context.Context, key, token string) error
+	// Get returns the stored response for key, or nil when there is none.
+	Get(ctx context.Context, key string) (*IdempotentResponse, error)
+	// Set stores res for key for ttl.
+	Set(ctx context.Context, key string, res *IdempotentResponse, ttl time.Duration) error
+}
+
+// IdempotencyConfig defines the config for Idempotency middleware.
+type IdempotencyConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Store keeps locks and responses.
+	// Default is an in-memory store, which is per instance.
+	Store IdempotencyStore
+
+	// Methods the middleware applies to.
+	// Default is POST and PATCH.
+	Methods []string
+
+	// KeyPrefix namespaces keys in the store.
+	// Default is "idempotency:".
+	KeyPrefix string
+
+	// Scope returns the caller a key belongs to, so callers cannot replay
+	// each other's responses by reusing a key.
+	// Default is IdempotencyBySubject.
+	Scope func(c echo.Context) string
+
+	// TTL is how long a response is replayed.
+	// Default is 24 hours.
+	TTL time.Duration
+
+	// LockTTL bounds how long an in-flight request holds its key.
+	// Default is 1 minute.
+	LockTTL time.Duration
+
+	// Required rejects requests without an Idempotency-Key header.
+	Required bool
+
+	// MaxBodySize is the largest request body hashed; larger requests
+	// carrying a key are rejected with 413 Request Entity Too Large.
+	// Default is 1MB.
+	MaxBodySize int
+}
+
+var (
+	// DefaultIdempotencyConfig is the default Idempotency middleware config.
+	DefaultIdempotencyConfig = IdempotencyConfig{
+		Skipper:     DefaultSkipper,
+		Methods:     []string{http.MethodPost, http.MethodPatch},
+		KeyPrefix:   "idempotency:",
+		Scope:       IdempotencyBySubject,
+		TTL:         24 * time.Hour,
+		LockTTL:     time.Minute,
+		MaxBodySize: 1 << 20,
+	}
+)
+
+// Idempotency returns a middleware that replays the first response for
+// requests repeating an Idempotency-Key.
+func Idempotency() echo.MiddlewareFunc {
+	return IdempotencyWithConfig(DefaultIdempotencyConfig)
+}
+
+// IdempotencyWithConfig returns an Idempotency middleware with config.
+func IdempotencyWithConfig(config IdempotencyConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultIdempotencyConfig.Skipper
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if len(config.Methods) == 0 {
+		config.Methods = DefaultIdempotencyConfig.Methods
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultIdempotencyConfig.KeyPrefix
+	}
+	if config.Scope == nil {
+		config.Scope = DefaultIdempotencyConfig.Scope
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultIdempotencyConfig.TTL
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = DefaultIdempotencyConfig.LockTTL
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = DefaultIdempotencyConfig.MaxBodySize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Skipper(c) || !containsFold(config.Methods, req.Method) {
+				return next(c)
+			}
+
+			ikey := req.Header.Get(HeaderIdempotencyKey)
+			if ikey == "" {
+				if config.Required {
+					return echo.NewHTTPError(http.StatusBadRequest, "missing "+HeaderIdempotencyKey+" header")
+				}
+				return next(c)
+			}
+
+			ctx := req.Context()
+			key := config.KeyPrefix + config.Scope(c) + ":" + req.Method + ":" + c.Path() + ":" + ikey
+			log := logx.WithContext(ctx).WithField("idempotency_key", ikey)
+
+			body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(config.MaxBodySize)+1))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if len(body) > config.MaxBodySize {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			hash := hex.EncodeToString(sum[:])
+
+			if stored, err := config.Store.Get(ctx, key); err != nil {
+				return err
+			} else if stored != nil {
+				return replayIdempotentResponse(c, log, stored, hash)
+			}
+
+			token := uuid.New().String()
+			ok, err := config.Store.Lock(ctx, key, token, config.LockTTL)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// the first request may have finished between Get and Lock
+				if stored, err := config.Store.Get(ctx, key); err == nil && stored != nil {
+					return replayIdempotentResponse(c, log, stored, hash)
+				}
+				log.Warn("idempotency request in flight")
+				return echo.NewHTTPError(http.StatusConflict, "a request with this "+HeaderIdempotencyKey+" is in progress")
+			}
+			defer func() {
+				ctx, cancel := detachIdempotency(ctx)
+				defer cancel()
+				if err := config.Store.Unlock(ctx, key, token); err != nil {
+					log.WithField("error", err).Error("idempotency unlock error")
+				}
+			}()
+
+			res := c.Response()
+			resBody := new(bytes.Buffer)
+			mw := io.MultiWriter(res.Writer, resBody)
+			writer := &bodyDumpResponseWriter{Writer: mw, ResponseWriter: res.Writer}
+			res.Writer = writer
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			// server errors are not stored so the client can retry them
+			if res.Status >= http.StatusInternalServerError {
+				return nil
+			}
+
+			stored := &IdempotentResponse{
+				Status: res.Status,
+				Header: res.Header().Clone(),
+				Body:   resBody.Bytes(),
+
+				RequestHash: hash,
+			}
+			sctx, cancel := detachIdempotency(ctx)
+			defer cancel()
+			if err := config.Store.Set(sctx, key, stored, config.TTL); err != nil {
+				log.WithField("error", err).Error("idempotency store response error")
+			}
+
+			return nil
+		}
+	}
+}
+
+// detachIdempotency returns a context for store calls made after the handler
+// returned, detached from the request so the response is stored and the key
+// released even when the client is gone; otherwise retries would be locked
+// out until LockTTL.
+func detachIdempotency(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(contextx.SetID(context.Background(), contextx.GetID(ctx)), idempotencyStoreTimeout)
+}
+
+// IdempotencyBySubject scopes keys to the authenticated subject in the
+// request context, falling back to the client IP for anonymous requests.
+func IdempotencyBySubject(c echo.Context) string {
+	if subject := contextx.GetSubject(c.Request().Context()); subject != "" {
+		return "sub:" + subject
+	}
+	return "ip:" + ClientIP(c)
+}
+
+func replayIdempotentResponse(c echo.Context, log logrus.FieldLogger, stored *IdempotentResponse, hash string) error {
+	if stored.RequestHash != hash {
+		log.Warn("idempotency key reused with a different body")
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, HeaderIdempotencyKey+" was used with a different request body")
+	}
+	log.Info("idempotency replay response")
+
+	h := c.Response().Header()
+	for k, v := range stored.Header {
+		if k == echo.HeaderXRequestID {
+			continue
+		}
+		h[k] = v
+	}
+	h.Set(HeaderIdempotentReplayed, "true")
+
+	c.Response().WriteHeader(stored.Status)
+	_, err := c.Response().Write(stored.Body)
+	return err
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// MemoryIdempotencyStore keeps idempotency state in process memory.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	locks     map[string]memoryIdempotencyLock
+	responses map[string]memoryIdempotentResponse
+	lastSweep time.Time
+}
+
+type memoryIdempotencyLock struct {
+	token   string
+	expires time.Time
+}
+
+type memoryIdempotentResponse struct {
+	res     *IdempotentResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty in-memory store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		locks:     make(map[string]memoryIdempotencyLock),
+		responses: make(map[string]memoryIdempotentResponse),
+		lastSweep: time.Now(),
+	}
+}
+
+// Lock implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	if l, ok := s.locks[key]; ok && now.Before(l.expires) {
+		return false, nil
+	}
+	s.locks[key] = memoryIdempotencyLock{token: token, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Unlock implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Unlock(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.locks[key]; ok && l.token == token {
+		delete(s.locks, key)
+	}
+	return nil
+}
+
+// Get implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(stored.expires) {
+		delete(s.responses, key)
+		return nil, nil
+	}
+	return stored.res, nil
+}
+
+// Set implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Set(ctx context.Context, key string, res *IdempotentResponse, ttl time.Duration) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	s.responses[key] = memoryIdempotentResponse{res: res, expires: now.Add(ttl)}
+	return nil
+}
+
+// sweep drops expired locks and responses at most once a minute.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for k, l := range s.locks {
+		if now.After(l.expires) {
+			delete(s.locks, k)
+		}
+	}
+	for k, stored := range s.responses {
+		if now.After(stored.expires) {
+			delete(s.responses, k)
+		}
+	}
+}
+
+var idempotencyUnlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// RedisIdempotencyStore keeps idempotency state in Redis so duplicates are
+// detected across instances.
+type RedisIdempotencyStore struct {
+	client redis.Cmdable
+}
+
+// NewRedisIdempotencyStore returns a store backed by client, e.g. the
+// redis.UniversalClient embedded in a redisx.Client.
+func NewRedisIdempotencyStore(client redis.Cmdable) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client}
+}
+
+// Lock implements IdempotencyStore.
+func (s *RedisIdempotencyStore) Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	ok, err := s.client.SetNX(ctx, key+":lock", token, ttl).Result()
+	return ok, errors.WithStack(err)
+}
+
+// Unlock implements IdempotencyStore. The lock is deleted only if it still
+// holds token, so a request outliving its LockTTL never releases the lock
+// of the request that took over.
+func (s *RedisIdempotencyStore) Unlock(ctx context.Context, key, token string) error {
+	return errors.WithStack(idempotencyUnlockScript.Run(ctx, s.client, []string{key + ":lock"}, token).Err())
+}
+
+// Get implements IdempotencyStore.
+func (s *RedisIdempotencyStore) Get(ctx context.Context, key string) (*IdempotentResponse, error) {
+	b, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	res := new(IdempotentResponse)
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+// Set implements IdempotencyStore.
+func (s *RedisIdempotencyStore) Set(ctx context.Context, key string, res *IdempotentResponse, ttl time.Duration) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(s.client.Set(ctx, key, b, ttl).Err())
+}
@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// jwksFetchTimeout bounds a key download detached from the request.
+const jwksFetchTimeout = 10 * time.Second
+
+// JWKS fetches and caches the signing keys published at a JWKS endpoint.
+// Keys are refreshed every refresh interval, and early when a token names an
+// unknown key id, at most once per minRefresh. A failed fetch is not retried
+// for minRefresh either, so an unreachable endpoint does not slow every
+// request down.
+type JWKS struct {
+	url        string
+	client     *http.Client
+	refresh    time.Duration
+	minRefresh time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]interface{}
+	fetched time.Time
+	// attempts counts fetches so callers queued behind one do not repeat it
+	attempts uint64
+	failed   time.Time
+	fetchErr error
+
+	fetchMu sync.Mutex
+}
+
+// NewJWKS returns a JWKS for url. Keys are fetched lazily on first use.
+func NewJWKS(url string, client *http.Client, refresh time.Duration) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if refresh == 0 {
+		refresh = time.Hour
+	}
+
+	return &JWKS{
+		url:        url,
+		client:     client,
+		refresh:    refresh,
+		minRefresh: time.Minute,
+	}
+}
+
+// Key returns the public key with key id kid.
+func (j *JWKS) Key(ctx context.Context, kid string) (interface{}, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetched) > j.refresh
+	early := time.Since(j.fetched) > j.minRefresh
+	backoff := time.Since(j.failed) < j.minRefresh
+	fetchErr := j.fetchErr
+	j.mu.RUnlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+	if backoff {
+		if ok {
+			return key, nil
+		}
+		return nil, fetchErr
+	}
+	if ok || early {
+		if err := j.fetch(ctx); err != nil && !ok {
+			return nil, err
+		}
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.Errorf("jwks key %q not found", kid)
+}
+
+// fetch replaces the cached keys; concurrent callers share one request.
+// The download is detached from ctx, so a cancelled request does not fail
+// the callers sharing it, and only a successful one counts as fetched.
+func (j *JWKS) fetch(ctx context.Context) error {
+	attempts := j.attemptCount()
+
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	if j.attemptCount() != attempts {
+		return nil
+	}
+	j.mu.Lock()
+	j.attempts++
+	j.mu.Unlock()
+
+	dctx, cancel := context.WithTimeout(contextx.SetID(context.Background(), contextx.GetID(ctx)), jwksFetchTimeout)
+	defer cancel()
+
+	start := time.Now()
+	keys, err := j.download(dctx)
+
+	if err != nil {
+		logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+			"url":      j.url,
+			"error":    err,
+			"duration": time.Since(start).String(),
+		}).Error("jwks fetch error")
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.failed = time.Now()
+		j.fetchErr = err
+		return err
+	}
+
+	logx.WithContext(ctx).WithFields(logrus.Fields{
+		"url":      j.url,
+		"keys":     len(keys),
+		"duration": time.Since(start).String(),
+	}).Info("jwks fetch information")
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.fetched = time.Now()
+	j.failed = time.Time{}
+	j.fetchErr = nil
+	j.keys = keys
+	return nil
+}
+
+func (j *JWKS) attemptCount() uint64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.attempts
+}
+
+func (j *JWKS) download(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	res, err := j.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("jwks fetch status %s", res.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logx.WithContext(ctx).WithFields(logrus.Fields{
+				"kid":   k.Kid,
+				"error": err,
+			}).Warn("jwks skip key")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		b, err := base64.RawURLEncoding.DecodeString(k.K)
+		return b, errors.WithStack(err)
+	}
+	return nil, errors.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
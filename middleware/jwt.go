@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// JWTClaimsMapper maps validated claims to the request principal.
+type JWTClaimsMapper func(claims jwt.MapClaims) (*contextx.Principal, error)
+
+// JWTConfig defines the config for JWTWithConfig middleware.
+type JWTConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// JWKS resolves RS and ES verification keys by the token's kid.
+	// Use NewJWKS for a rotating JWKS endpoint.
+	JWKS *JWKS
+
+	// HMACSecret verifies HS tokens. HS algorithms are only accepted when
+	// it is set.
+	HMACSecret []byte
+
+	// Algorithms lists the accepted signing algorithms.
+	// Default is RS256/384/512 and ES256/384/512, plus HS256/384/512 when
+	// HMACSecret is set.
+	Algorithms []string
+
+	// Issuer is the required iss claim, if set.
+	Issuer string
+
+	// Audience lists accepted aud values; a token must carry one of them.
+	Audience []string
+
+	// ClockSkew tolerated when checking exp, nbf and iat.
+	// Default is 30 seconds.
+	ClockSkew time.Duration
+
+	// ClaimsMapper builds the principal stored on the request context.
+	// Default is DefaultJWTClaimsMapper.
+	ClaimsMapper JWTClaimsMapper
+}
+
+var (
+	// DefaultJWTConfig is the default JWTWithConfig middleware config.
+	DefaultJWTConfig = JWTConfig{
+		Skipper:      DefaultSkipper,
+		ClockSkew:    30 * time.Second,
+		ClaimsMapper: DefaultJWTClaimsMapper,
+	}
+)
+
+// JWT is a pass-through to echo's JWT middleware.
+//
+// Deprecated: use JWTWithConfig.
+func JWT(i interface{}) echo.MiddlewareFunc {
+	return middleware.JWT(i)
+}
+
+// JWTWithConfig returns a middleware that validates bearer tokens and stores
+// the mapped principal on the request context, see contextx.GetPrincipal.
+func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultJWTConfig.Skipper
+	}
+	if config.ClockSkew == 0 {
+		config.ClockSkew = DefaultJWTConfig.ClockSkew
+	}
+	if config.ClaimsMapper == nil {
+		config.ClaimsMapper = DefaultJWTConfig.ClaimsMapper
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+		if len(config.HMACSecret) > 0 {
+			config.Algorithms = append(config.Algorithms, "HS256", "HS384", "HS512")
+		}
+	}
+	if config.JWKS == nil && len(config.HMACSecret) == 0 {
+		panic("echo: jwt middleware requires a JWKS or HMAC secret")
+	}
+
+	parser := &jwt.Parser{
+		ValidMethods:         config.Algorithms,
+		SkipClaimsValidation: true,
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := req.Context()
+
+			principal, err := config.authenticate(c, parser)
+			if err != nil {
+				logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Warn("jwt authentication failed")
+
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired token").SetInternal(err)
+			}
+
+			ctx = contextx.SetPrincipal(ctx, principal)
+			c.SetRequest(req.WithContext(ctx))
+
+			logx.WithContext(ctx).WithFields(logrus.Fields{
+				"issuer": principal.Issuer,
+			}).Info("jwt authenticated")
+
+			return next(c)
+		}
+	}
+}
+
+func (config JWTConfig) authenticate(c echo.Context, parser *jwt.Parser) (*contextx.Principal, error) {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) <= len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return nil, errors.New("missing bearer token")
+	}
+
+	ctx := c.Request().Context()
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(auth[len("Bearer "):], claims, func(t *jwt.Token) (interface{}, error) {
+		if strings.HasPrefix(t.Method.Alg(), "HS") {
+			if len(config.HMACSecret) == 0 {
+				return nil, errors.Errorf("no secret for algorithm %s", t.Method.Alg())
+			}
+			return config.HMACSecret, nil
+		}
+		if config.JWKS == nil {
+			return nil, errors.Errorf("no jwks for algorithm %s", t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return config.JWKS.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := config.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return config.ClaimsMapper(claims)
+}
+
+func (config JWTConfig) validate(claims jwt.MapClaims) error {
+	now := time.Now()
+	skew := config.ClockSkew
+
+	if !claims.VerifyExpiresAt(now.Add(-skew).Unix(), true) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(skew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(skew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+	if config.Issuer != "" && !claims.VerifyIssuer(config.Issuer, true) {
+		return errors.New("invalid issuer")
+	}
+	if len(config.Audience) > 0 {
+		for _, aud := range config.Audience {
+			if claims.VerifyAudience(aud, true) {
+				return nil
+			}
+		}
+		return errors.New("invalid audience")
+	}
+	return nil
+}
+
+// DefaultJWTClaimsMapper maps the registered claims, the space separated
+// "scope" or array "scp" claim and the "roles" claim.
+func DefaultJWTClaimsMapper(claims jwt.MapClaims) (*contextx.Principal, error) {
+	p := &contextx.Principal{
+		Claims: claims,
+	}
+	p.Subject, _ = claims["sub"].(string)
+	p.Issuer, _ = claims["iss"].(string)
+	p.Audience = claimStrings(claims["aud"])
+	if p.Subject == "" {
+		return nil, errors.New("missing sub claim")
+	}
+
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = claimStrings(claims["scp"])
+	}
+	p.Roles = claimStrings(claims["roles"])
+
+	return p, nil
+}
+
+// claimStrings reads a claim that is either a string or an array of strings.
+func claimStrings(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, s := range t {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,388 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+const redacted = "[REDACTED]"
+
+// LoggerConfig defines the config for Logger middleware.
+type LoggerConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// BodyContentTypes is the allow-list of content type prefixes whose
+	// bodies are logged. An empty list logs no bodies.
+	BodyContentTypes []string
+
+	// MaxBodySize is the maximum number of bytes captured from request and
+	// response bodies. Nothing beyond this limit is buffered.
+	// Default is logx.LimitMSG.
+	MaxBodySize int
+
+	// RedactHeaders lists header names whose values are replaced in logs.
+	RedactHeaders []string
+
+	// RedactFields lists JSON field names whose values are replaced in
+	// logged bodies, at any depth. Bodies that are not valid JSON are not
+	// logged when this is set.
+	RedactFields []string
+
+	// OnlyErrorsOrSlow logs only requests that fail (status >= 400 or a
+	// handler error) or take longer than SlowThreshold.
+	OnlyErrorsOrSlow bool
+
+	// SlowThreshold marks requests slower than this as slow and logs them
+	// at warning severity with a timing breakdown. Zero disables slow
+	// detection.
+	SlowThreshold time.Duration
+
+	// Sampling limits which requests have their bodies logged. Nil logs
+	// bodies for every request.
+	Sampling *LogSampling
+}
+
+// LogSampling decides which requests have their bodies logged. Bodies are
+// still captured up to MaxBodySize for every request, so that failed and
+// slow requests can log them after the fact.
+type LogSampling struct {
+	// Rate is the fraction, from 0 to 1, of requests whose bodies are
+	// logged.
+	Rate float64
+
+	// Routes overrides Rate per route, keyed by the registered route path,
+	// e.g. "/users/:id".
+	Routes map[string]float64
+
+	// LatencyThreshold logs bodies of requests slower than this.
+	// Default is the Logger SlowThreshold.
+	LatencyThreshold time.Duration
+
+	// SkipServerErrors stops bodies of 5xx responses from always being
+	// logged.
+	SkipServerErrors bool
+}
+
+// sampled reports whether the bodies of a request to route are logged
+// regardless of its outcome.
+func (s *LogSampling) sampled(route string) bool {
+	rate, ok := s.Routes[route]
+	if !ok {
+		rate = s.Rate
+	}
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+// keep reports whether the bodies of a request that was not sampled are
+// logged anyway.
+func (s *LogSampling) keep(status int, duration time.Duration) bool {
+	if !s.SkipServerErrors && status >= http.StatusInternalServerError {
+		return true
+	}
+	return s.LatencyThreshold > 0 && duration > s.LatencyThreshold
+}
+
+var (
+	// DefaultLoggerConfig is the default Logger middleware config.
+	DefaultLoggerConfig = LoggerConfig{
+		Skipper: DefaultSkipper,
+		BodyContentTypes: []string{
+			echo.MIMEApplicationJSON,
+			MIMEApplicationProblemJSON,
+			echo.MIMEApplicationXML,
+			echo.MIMETextXML,
+			echo.MIMEApplicationForm,
+			"text/plain",
+		},
+		RedactHeaders: []string{
+			echo.HeaderAuthorization,
+			echo.HeaderCookie,
+			echo.HeaderSetCookie,
+			"Proxy-Authorization",
+			"X-Api-Key",
+		},
+	}
+)
+
+// Logger returns a middleware that logs request and response information.
+func Logger() echo.MiddlewareFunc {
+	return LoggerWithConfig(DefaultLoggerConfig)
+}
+
+// LoggerWithConfig returns a Logger middleware with config.
+func LoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultLoggerConfig.Skipper
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = logx.LimitMSG
+	}
+	if config.Sampling != nil && config.Sampling.LatencyThreshold == 0 {
+		sampling := *config.Sampling
+		sampling.LatencyThreshold = config.SlowThreshold
+		config.Sampling = &sampling
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			res := c.Response()
+			ctx := req.Context()
+			start := time.Now()
+			timing := &requestTiming{}
+
+			reqBody := &limitBuffer{limit: config.MaxBodySize}
+			if req.Body != nil && config.logBody(req.Header.Get(echo.HeaderContentType)) {
+				head, _ := ioutil.ReadAll(io.LimitReader(req.Body, int64(config.MaxBodySize)+1))
+				reqBody.Write(head)
+				req.Body = readCloser{
+					Reader: io.MultiReader(bytes.NewReader(head), req.Body),
+					Closer: req.Body,
+				}
+			}
+			if req.Body != nil {
+				req.Body = readCloser{
+					Reader: &timedReader{Reader: req.Body, d: &timing.read},
+					Closer: req.Body,
+				}
+			}
+			timing.read = time.Since(start)
+
+			sampled := config.Sampling == nil || config.Sampling.sampled(c.Path())
+
+			reqFields := logrus.Fields{
+				"header": config.redactHeader(req.Header),
+			}
+			if sampled {
+				reqFields["body"] = config.redactBody(reqBody)
+			}
+			if !config.OnlyErrorsOrSlow {
+				logx.WithContext(ctx).WithFields(reqFields).Info("echo request information")
+			}
+
+			resBody := &limitBuffer{limit: config.MaxBodySize}
+			mw := io.MultiWriter(&timedWriter{Writer: res.Writer, d: &timing.write}, resBody)
+			writer := &bodyDumpResponseWriter{Writer: mw, ResponseWriter: res.Writer}
+			res.Writer = writer
+			res.Before(func() { timing.firstByte = time.Since(start) })
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			duration := time.Since(start)
+			slow := config.SlowThreshold > 0 && duration > config.SlowThreshold
+			failed := err != nil || res.Status >= http.StatusBadRequest
+			keep := sampled || config.Sampling.keep(res.Status, duration)
+			if config.OnlyErrorsOrSlow {
+				if !slow && !failed {
+					return nil
+				}
+				if keep {
+					reqFields["body"] = config.redactBody(reqBody)
+				}
+				logx.WithContext(ctx).WithFields(reqFields).Info("echo request information")
+			}
+
+			if !keep || !config.logBody(res.Header().Get(echo.HeaderContentType)) {
+				resBody.reset()
+			}
+
+			fields := logrus.Fields{
+				"header":          config.redactHeader(res.Header()),
+				"body":            config.redactBody(resBody),
+				"method":          req.Method,
+				"host":            req.Host,
+				"path_uri":        req.RequestURI,
+				"remote_ip":       c.RealIP(),
+				"status":          res.Status,
+				"duration_string": duration.String(),
+				"duration":        duration,
+			}
+			if keep && !sampled && !config.OnlyErrorsOrSlow {
+				// the request line went out without its body
+				fields["request_body"] = config.redactBody(reqBody)
+			}
+
+			log := logx.WithContext(ctx).WithFields(fields)
+			if slow {
+				log.WithFields(logrus.Fields{
+					"slow_threshold": config.SlowThreshold.String(),
+					"timing":         timing.breakdown(duration),
+				}).Warn("echo slow response information")
+				return nil
+			}
+			log.Info("echo response information")
+
+			return nil
+		}
+	}
+}
+
+func (config LoggerConfig) logBody(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range config.BodyContentTypes {
+		if strings.HasPrefix(contentType, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (config LoggerConfig) redactHeader(h http.Header) http.Header {
+	if len(config.RedactHeaders) == 0 {
+		return h
+	}
+
+	out := h.Clone()
+	for _, k := range config.RedactHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(k)]; ok {
+			out.Set(k, redacted)
+		}
+	}
+	return out
+}
+
+func (config LoggerConfig) redactBody(b *limitBuffer) string {
+	if len(config.RedactFields) == 0 || b.buf.Len() == 0 {
+		return b.String()
+	}
+
+	var v interface{}
+	if b.truncated || json.Unmarshal(b.buf.Bytes(), &v) != nil {
+		return redacted
+	}
+
+	out, err := json.Marshal(redactJSON(v, config.RedactFields))
+	if err != nil {
+		return redacted
+	}
+	return string(out)
+}
+
+func redactJSON(v interface{}, fields []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if containsFold(fields, k) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactJSON(val, fields)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactJSON(val, fields)
+		}
+	}
+	return v
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// limitBuffer keeps at most limit bytes and silently discards the rest, so it
+// is safe to use as a tee target without buffering whole bodies.
+type limitBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitBuffer) reset() {
+	b.buf.Reset()
+	b.truncated = false
+}
+
+func (b *limitBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "..."
+	}
+	return b.buf.String()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// requestTiming splits a request's duration into reading the request body,
+// the handler's time to first byte and writing the response body.
+type requestTiming struct {
+	read      time.Duration
+	firstByte time.Duration
+	write     time.Duration
+}
+
+func (t *requestTiming) breakdown(total time.Duration) logrus.Fields {
+	fields := logrus.Fields{
+		"request_read":   t.read.String(),
+		"response_write": t.write.String(),
+		"total":          total.String(),
+	}
+	if t.firstByte > 0 {
+		fields["first_byte"] = t.firstByte.String()
+	}
+	return fields
+}
+
+// timedReader adds the time spent in Read to d.
+type timedReader struct {
+	io.Reader
+	d *time.Duration
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.Reader.Read(p)
+	*r.d += time.Since(start)
+	return n, err
+}
+
+// timedWriter adds the time spent in Write to d.
+type timedWriter struct {
+	io.Writer
+	d *time.Duration
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.Writer.Write(p)
+	*w.d += time.Since(start)
+	return n, err
+}
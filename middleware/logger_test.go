@@ -0,0 +1,66 @@
+package middleware
+
+import "testing"
+
+func TestLoggerRedactBody(t *testing.T) {
+	config := LoggerConfig{RedactFields: []string{"password", "token"}}
+
+	tests := []struct {
+		name   string
+		config LoggerConfig
+		body   string
+		limit  int
+		want   string
+	}{
+		{
+			name:   "top level field",
+			config: config,
+			body:   `{"user":"a","password":"x"}`,
+			want:   `{"password":"[REDACTED]","user":"a"}`,
+		},
+		{
+			name:   "nested fields, any case",
+			config: config,
+			body:   `{"a":{"Token":"t"},"list":[{"password":"p","n":1}]}`,
+			want:   `{"a":{"Token":"[REDACTED]"},"list":[{"n":1,"password":"[REDACTED]"}]}`,
+		},
+		{
+			name:   "not JSON",
+			config: config,
+			body:   `password=x`,
+			want:   redacted,
+		},
+		{
+			name:   "truncated",
+			config: config,
+			body:   `{"user":"a","password":"x"}`,
+			limit:  10,
+			want:   redacted,
+		},
+		{
+			name:   "empty",
+			config: config,
+			want:   "",
+		},
+		{
+			name: "no fields",
+			body: `{"password":"x"}`,
+			want: `{"password":"x"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := tt.limit
+			if limit == 0 {
+				limit = 1 << 10
+			}
+			b := &limitBuffer{limit: limit}
+			b.Write([]byte(tt.body))
+
+			if got := tt.config.redactBody(b); got != tt.want {
+				t.Errorf("redactBody(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
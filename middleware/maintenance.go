@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+	"github.com/tOnkowzl/libs/viperx"
+)
+
+// MaintenanceConfig defines the config for Maintenance middleware. It can be
+// loaded from viper with NewMaintenanceFromViper.
+type MaintenanceConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper `mapstructure:"-"`
+
+	// Enabled puts the whole service into maintenance.
+	Enabled bool `mapstructure:"enabled"`
+
+	// Routes puts only these routes into maintenance when Enabled is off.
+	// Entries are registered route paths, e.g. "/users/:id", or request path
+	// prefixes ending in "*", e.g. "/v1/orders*".
+	Routes []string `mapstructure:"routes"`
+
+	// RetryAfter is sent as the Retry-After header. Zero omits it.
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+
+	// Message is the problem detail of maintenance responses.
+	// Default is "service under maintenance".
+	Message string `mapstructure:"message"`
+
+	// BypassIPs lists client IPs or CIDRs that are let through. They are
+	// matched against ClientIP, so behind a proxy e.IPExtractor must be set.
+	BypassIPs []string `mapstructure:"bypass_ips"`
+
+	// BypassHeaders lets through requests carrying one of these header
+	// values, keyed by header name.
+	BypassHeaders map[string]string `mapstructure:"bypass_headers"`
+}
+
+var (
+	// DefaultMaintenanceConfig is the default Maintenance middleware config.
+	DefaultMaintenanceConfig = MaintenanceConfig{
+		Skipper: DefaultSkipper,
+		Message: "service under maintenance",
+	}
+)
+
+// Maintenance answers requests with 503 Service Unavailable while its config
+// says so. The config can be swapped at runtime with Update, or follow a
+// viper key with NewMaintenanceFromViper:
+//
+//	m, err := middleware.NewMaintenanceFromViper(ctx, "http.maintenance")
+//	e.Use(m.Middleware())
+type Maintenance struct {
+	state atomic.Value
+}
+
+type maintenanceState struct {
+	config MaintenanceConfig
+	nets   []*net.IPNet
+}
+
+// NewMaintenance returns a Maintenance applying config.
+func NewMaintenance(config MaintenanceConfig) *Maintenance {
+	m := &Maintenance{}
+	m.Update(config)
+	return m
+}
+
+// NewMaintenanceFromViper returns a Maintenance applying the config at viper
+// key, reloaded whenever the config file changes. A reload that fails to
+// unmarshal keeps the previous config.
+func NewMaintenanceFromViper(ctx context.Context, key string) (*Maintenance, error) {
+	var config MaintenanceConfig
+	if err := viperx.UnmarshalKey(ctx, key, &config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	m := NewMaintenance(config)
+
+	viperx.Watch(func() {
+		var config MaintenanceConfig
+		if err := viperx.UnmarshalKey(context.Background(), key, &config); err != nil {
+			logx.WithSeverityError(context.Background()).WithFields(logrus.Fields{
+				"key":   key,
+				"error": err,
+			}).Error("maintenance config reload error")
+			return
+		}
+		m.Update(config)
+	})
+	return m, nil
+}
+
+// MaintenanceWithConfig returns a Maintenance middleware with a fixed config.
+func MaintenanceWithConfig(config MaintenanceConfig) echo.MiddlewareFunc {
+	return NewMaintenance(config).Middleware()
+}
+
+// Update replaces the config; requests already running are not affected.
+func (m *Maintenance) Update(config MaintenanceConfig) {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultMaintenanceConfig.Skipper
+	}
+	if config.Message == "" {
+		config.Message = DefaultMaintenanceConfig.Message
+	}
+
+	s := &maintenanceState{config: config}
+	for _, ip := range config.BypassIPs {
+		if !strings.Contains(ip, "/") {
+			if strings.Contains(ip, ":") {
+				ip += "/128"
+			} else {
+				ip += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(ip)
+		if err != nil {
+			logx.WithSeverityWarn(context.Background()).WithField("ip", ip).Warn("maintenance bypass ip ignored")
+			continue
+		}
+		s.nets = append(s.nets, n)
+	}
+
+	m.state.Store(s)
+}
+
+// Middleware returns the maintenance middleware.
+func (m *Maintenance) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			s := m.state.Load().(*maintenanceState)
+			config := s.config
+			if config.Skipper(c) || !s.matches(c) || s.bypass(c) {
+				return next(c)
+			}
+
+			logx.WithContext(c.Request().Context()).WithFields(logrus.Fields{
+				"route":  c.Path(),
+				"method": c.Request().Method,
+			}).Info("request rejected: maintenance")
+
+			if config.RetryAfter > 0 {
+				c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(config.RetryAfter)))
+			}
+			return WriteProblem(c, http.StatusServiceUnavailable, NewProblem(c, http.StatusServiceUnavailable, config.Message))
+		}
+	}
+}
+
+func (s *maintenanceState) matches(c echo.Context) bool {
+	if s.config.Enabled {
+		return true
+	}
+
+	path := c.Request().URL.Path
+	for _, r := range s.config.Routes {
+		if strings.HasSuffix(r, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(r, "*")) {
+				return true
+			}
+			continue
+		}
+		if r == c.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *maintenanceState) bypass(c echo.Context) bool {
+	if len(s.nets) > 0 {
+		if ip := net.ParseIP(ClientIP(c)); ip != nil {
+			for _, n := range s.nets {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+
+	for k, v := range s.config.BypassHeaders {
+		got := c.Request().Header.Get(k)
+		if got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(v)) == 1 {
+			return true
+		}
+	}
+	return false
+}
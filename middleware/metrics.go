@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is the path MetricsHandler is expected to be served on.
+const MetricsPath = "/metrics"
+
+// MetricsConfig defines the config for Metrics middleware.
+type MetricsConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default skips DefaultSkipper routes and MetricsPath.
+	Skipper Skipper
+
+	// Namespace and Subsystem prefix every metric name.
+	Namespace string
+	Subsystem string
+
+	// Buckets of the request duration histogram in seconds.
+	// Default is prometheus.DefBuckets.
+	Buckets []float64
+
+	// SizeBuckets of the response size histogram in bytes.
+	// Default is exponential from 100B to 100MB.
+	SizeBuckets []float64
+
+	// Registerer registers the collectors.
+	// Default is prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+var (
+	// DefaultMetricsConfig is the default Metrics middleware config.
+	DefaultMetricsConfig = MetricsConfig{
+		Skipper:     ChainSkipper(DefaultSkipper, PathSkipper(MetricsPath)),
+		Namespace:   "echo",
+		Buckets:     prometheus.DefBuckets,
+		SizeBuckets: prometheus.ExponentialBuckets(100, 10, 7),
+		Registerer:  prometheus.DefaultRegisterer,
+	}
+)
+
+// Metrics returns a middleware that records Prometheus RED metrics.
+func Metrics() echo.MiddlewareFunc {
+	return MetricsWithConfig(DefaultMetricsConfig)
+}
+
+// MetricsWithConfig returns a Metrics middleware with config.
+func MetricsWithConfig(config MetricsConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultMetricsConfig.Skipper
+	}
+	if config.Buckets == nil {
+		config.Buckets = DefaultMetricsConfig.Buckets
+	}
+	if config.SizeBuckets == nil {
+		config.SizeBuckets = DefaultMetricsConfig.SizeBuckets
+	}
+	if config.Registerer == nil {
+		config.Registerer = DefaultMetricsConfig.Registerer
+	}
+
+	labels := []string{"route", "method", "status"}
+
+	requests := registerCollector(config.Registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests processed.",
+	}, labels)).(*prometheus.CounterVec)
+
+	duration := registerCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency in seconds.",
+		Buckets:   config.Buckets,
+	}, labels)).(*prometheus.HistogramVec)
+
+	size := registerCollector(config.Registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "response_size_bytes",
+		Help:      "HTTP response size in bytes.",
+		Buckets:   config.SizeBuckets,
+	}, labels)).(*prometheus.HistogramVec)
+
+	inFlight := registerCollector(config.Registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: config.Namespace,
+		Subsystem: config.Subsystem,
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being served.",
+	}, []string{"route", "method"})).(*prometheus.GaugeVec)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			route := c.Path()
+			method := c.Request().Method
+
+			gauge := inFlight.WithLabelValues(route, method)
+			gauge.Inc()
+			defer gauge.Dec()
+
+			start := time.Now()
+			err := next(c)
+			elapsed := time.Since(start)
+
+			status := strconv.Itoa(responseStatus(c, err))
+			requests.WithLabelValues(route, method, status).Inc()
+			duration.WithLabelValues(route, method, status).Observe(elapsed.Seconds())
+			size.WithLabelValues(route, method, status).Observe(float64(c.Response().Size))
+
+			return err
+		}
+	}
+}
+
+// MetricsHandler returns a handler serving metrics of the default gatherer.
+func MetricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
+
+// MetricsHandlerFor returns a handler serving metrics of the given gatherer.
+func MetricsHandlerFor(gatherer prometheus.Gatherer) echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+// registerCollector registers c, returning the already registered collector
+// when an identical one exists so the middleware can be built more than once.
+func registerCollector(r prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	if err := r.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+// responseStatus returns the status the client will see for err, which the
+// error handler has not written yet when err is returned up the chain.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	return toError(err).Status
+}
@@ -2,73 +2,71 @@ package middleware
 
 import (
 	"bufio"
-	"bytes"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"net"
 	"net/http"
-	"runtime"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"github.com/sirupsen/logrus"
 	"github.com/tOnkowzl/libs/contextx"
-	"github.com/tOnkowzl/libs/logx"
 )
 
 var (
 	// DefaultSkipper default of skipper
 	DefaultSkipper = func(c echo.Context) bool {
-		return c.Path() == "/health"
+		switch c.Path() {
+		case "/health", LivezPath, ReadyzPath:
+			return true
+		}
+		return false
 	}
 )
 
 // Skipper skip middleware
 type Skipper func(c echo.Context) bool
 
-// Recover returns a middleware which recovers from panics anywhere in the chain
-// and handles the control to the centralized HTTPErrorHandler.
-func Recover() echo.MiddlewareFunc {
-	return RecoverWithConfig(middleware.DefaultRecoverConfig)
-}
-
-func RecoverWithConfig(config middleware.RecoverConfig) echo.MiddlewareFunc {
-	// Defaults
-	if config.Skipper == nil {
-		config.Skipper = middleware.DefaultRecoverConfig.Skipper
+// PathSkipper returns a Skipper that skips the given route paths (c.Path()).
+func PathSkipper(paths ...string) Skipper {
+	m := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		m[p] = struct{}{}
 	}
-	if config.StackSize == 0 {
-		config.StackSize = middleware.DefaultRecoverConfig.StackSize
+
+	return func(c echo.Context) bool {
+		_, ok := m[c.Path()]
+		return ok
 	}
+}
 
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			if config.Skipper(c) {
-				return next(c)
+// ChainSkipper returns a Skipper that skips when any of the given skippers does.
+func ChainSkipper(skippers ...Skipper) Skipper {
+	return func(c echo.Context) bool {
+		for _, skip := range skippers {
+			if skip != nil && skip(c) {
+				return true
 			}
-
-			defer func() {
-				if r := recover(); r != nil {
-					err, ok := r.(error)
-					if !ok {
-						err = fmt.Errorf("%v", r)
-					}
-					stack := make([]byte, config.StackSize)
-					length := runtime.Stack(stack, !config.DisableStackAll)
-					if !config.DisablePrintStack {
-						logx.WithContext(c.Request().Context()).Errorf("[PANIC RECOVER] %v %s\n", err, stack[:length])
-					}
-					c.Error(err)
-				}
-			}()
-			return next(c)
 		}
+		return false
 	}
 }
 
+// ClientIP returns the client IP for security decisions such as rate limits
+// and allow-lists. Forwarding headers are only trusted through
+// e.IPExtractor, which must be set, e.g. to echo.ExtractIPFromXFFHeader(),
+// when running behind a trusted proxy; otherwise the remote address of the
+// connection is used.
+func ClientIP(c echo.Context) string {
+	if c.Echo().IPExtractor != nil {
+		return c.RealIP()
+	}
+
+	addr := c.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 // RequestID returns a X-Request-ID middleware.
 func RequestID() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
@@ -93,56 +91,6 @@ func RequestID() echo.MiddlewareFunc {
 	}
 }
 
-func Logger() echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			if DefaultSkipper(c) {
-				return next(c)
-			}
-
-			req := c.Request()
-			res := c.Response()
-			ctx := req.Context()
-
-			b := make([]byte, 0)
-			if req.Body != nil {
-				b, _ = ioutil.ReadAll(req.Body)
-			}
-			req.Body = ioutil.NopCloser(bytes.NewBuffer(b))
-
-			logx.WithContext(ctx).WithFields(logrus.Fields{
-				"header": req.Header,
-				"body":   logx.LimitMSGByte(b),
-			}).Info("echo request information")
-
-			resBody := new(bytes.Buffer)
-			mw := io.MultiWriter(res.Writer, resBody)
-			writer := &bodyDumpResponseWriter{Writer: mw, ResponseWriter: res.Writer}
-			res.Writer = writer
-
-			start := time.Now()
-			if err := next(c); err != nil {
-				c.Error(err)
-			}
-
-			duration := time.Since(start)
-			logx.WithContext(ctx).WithFields(logrus.Fields{
-				"header":          res.Header(),
-				"body":            logx.LimitMSGByte(resBody.Bytes()),
-				"method":          req.Method,
-				"host":            req.Host,
-				"path_uri":        req.RequestURI,
-				"remote_ip":       c.RealIP(),
-				"status":          res.Status,
-				"duration_string": duration.String(),
-				"duration":        duration,
-			}).Info("echo response information")
-
-			return nil
-		}
-	}
-}
-
 func Health() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -154,18 +102,6 @@ func Health() echo.MiddlewareFunc {
 	}
 }
 
-func JWT(i interface{}) echo.MiddlewareFunc {
-	return middleware.JWT(i)
-}
-
-func CORS() echo.MiddlewareFunc {
-	return middleware.CORS()
-}
-
-func Secure() echo.MiddlewareFunc {
-	return middleware.Secure()
-}
-
 type bodyDumpResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
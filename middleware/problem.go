@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tOnkowzl/libs/contextx"
+)
+
+// MIMEApplicationProblemJSON is the RFC 7807 problem details media type.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type      string `json:"type,omitempty"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// Code and Details are extension members for application errors.
+	Code    string      `json:"code,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// NewProblem returns a problem for status, titled by its status text.
+func NewProblem(c echo.Context, status int, detail string) *Problem {
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Request().URL.Path,
+		RequestID: contextx.GetID(c.Request().Context()),
+	}
+}
+
+// WriteProblem writes p with status as application/problem+json.
+func WriteProblem(c echo.Context, status int, p interface{}) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	c.Response().WriteHeader(status)
+	return json.NewEncoder(c.Response()).Encode(p)
+}
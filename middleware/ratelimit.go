@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Rate limit response headers.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+	HeaderXAPIKey            = "X-Api-Key"
+)
+
+// RateLimitAlgorithm selects how requests are counted.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills Limit tokens per Window up to Burst.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows Limit requests in any Window, approximated by
+	// weighting the previous fixed window.
+	SlidingWindow
+)
+
+// RateLimitRule describes how many requests a key may make.
+type RateLimitRule struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+
+	// Burst is the token bucket capacity. Default is Limit.
+	Burst int
+}
+
+// RateLimitResult is the outcome of taking one request from a store.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts requests per key.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+// RateLimitKeyExtractor returns the key a request is limited by.
+type RateLimitKeyExtractor func(c echo.Context) string
+
+// RateLimitConfig defines the config for RateLimit middleware.
+type RateLimitConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Rule applied to every key.
+	Rule RateLimitRule
+
+	// Store keeps the counters.
+	// Default is an in-memory store, which is per instance.
+	Store RateLimitStore
+
+	// KeyExtractor identifies the client.
+	// Default is RateLimitByIP.
+	KeyExtractor RateLimitKeyExtractor
+
+	// KeyPrefix namespaces keys in the store.
+	// Default is "ratelimit:".
+	KeyPrefix string
+
+	// DenyOnError rejects requests when the store fails. By default
+	// requests are allowed and the failure is logged.
+	DenyOnError bool
+}
+
+var (
+	// DefaultRateLimitConfig is the default RateLimit middleware config.
+	DefaultRateLimitConfig = RateLimitConfig{
+		Skipper:      DefaultSkipper,
+		KeyExtractor: RateLimitByIP,
+		KeyPrefix:    "ratelimit:",
+	}
+)
+
+// RateLimitByIP keys requests by ClientIP, so X-Forwarded-For is ignored
+// unless e.IPExtractor trusts it.
+func RateLimitByIP(c echo.Context) string {
+	return "ip:" + ClientIP(c)
+}
+
+// RateLimitBySubject keys requests by the authenticated subject in the
+// request context, falling back to the client IP for anonymous requests.
+func RateLimitBySubject(c echo.Context) string {
+	if subject := contextx.GetSubject(c.Request().Context()); subject != "" {
+		return "sub:" + subject
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitByAPIKey keys requests by the X-Api-Key header, falling back to
+// the client IP when it is absent.
+func RateLimitByAPIKey(c echo.Context) string {
+	if key := c.Request().Header.Get(HeaderXAPIKey); key != "" {
+		return "key:" + key
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimit returns a rate limit middleware applying rule per client IP.
+func RateLimit(rule RateLimitRule) echo.MiddlewareFunc {
+	config := DefaultRateLimitConfig
+	config.Rule = rule
+	return RateLimitWithConfig(config)
+}
+
+// RateLimitWithConfig returns a RateLimit middleware with config.
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultRateLimitConfig.Skipper
+	}
+	if config.KeyExtractor == nil {
+		config.KeyExtractor = DefaultRateLimitConfig.KeyExtractor
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = DefaultRateLimitConfig.KeyPrefix
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	if config.Rule.Limit <= 0 || config.Rule.Window <= 0 {
+		panic("echo: rate limit middleware requires a positive limit and window")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			key := config.KeyExtractor(c)
+
+			res, err := config.Store.Take(ctx, config.KeyPrefix+key, config.Rule)
+			if err != nil {
+				logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+					"key":   key,
+					"error": err,
+				}).Error("rate limit store error")
+				if config.DenyOnError {
+					return echo.ErrServiceUnavailable
+				}
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+			h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+			h.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				h.Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+					"key":         key,
+					"retry_after": res.RetryAfter.String(),
+				}).Warn("rate limit exceeded")
+				return echo.NewHTTPError(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+func (r RateLimitRule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// perToken is the time it takes the token bucket to refill one token.
+func (r RateLimitRule) perToken() time.Duration {
+	return r.Window / time.Duration(r.Limit)
+}
+
+// tokenBucketResult builds the result from the tokens left after a take.
+func (r RateLimitRule) tokenBucketResult(allowed bool, tokens float64) RateLimitResult {
+	perToken := float64(r.perToken())
+	res := RateLimitResult{
+		Allowed:   allowed,
+		Limit:     r.burst(),
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(r.burst()) - tokens) * perToken),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return res
+}
+
+// slidingWindowResult builds the result from the previous and current window
+// counts, curr including this request when it was allowed.
+func (r RateLimitRule) slidingWindowResult(allowed bool, prev, curr int64, elapsed time.Duration) RateLimitResult {
+	weight := float64(r.Window-elapsed) / float64(r.Window)
+	count := float64(prev)*weight + float64(curr)
+
+	res := RateLimitResult{
+		Allowed: allowed,
+		Limit:   r.Limit,
+		Reset:   r.Window - elapsed,
+	}
+	if remaining := int(float64(r.Limit) - count); remaining > 0 {
+		res.Remaining = remaining
+	}
+	if allowed {
+		return res
+	}
+
+	if curr+1 > int64(r.Limit) || prev == 0 {
+		res.RetryAfter = r.Window - elapsed
+		return res
+	}
+	// wait until the previous window's weight lets one more request in
+	w := float64(int64(r.Limit)-curr-1) / float64(prev)
+	res.RetryAfter = time.Duration((1-w)*float64(r.Window)) - elapsed
+	return res
+}
+
+// slidingWindowAllowed reports whether one more request fits the window.
+func (r RateLimitRule) slidingWindowAllowed(prev, curr int64, elapsed time.Duration) bool {
+	weight := float64(r.Window-elapsed) / float64(r.Window)
+	return float64(prev)*weight+float64(curr)+1 <= float64(r.Limit)
+}
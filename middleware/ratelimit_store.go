@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// MemoryRateLimitStore keeps counters in process memory. Limits are per
+// instance; use RedisRateLimitStore for multi-instance deployments.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	window     int64
+	prev, curr int64
+
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries:   make(map[string]*rateLimitEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(rule.burst()), last: now}
+		s.entries[key] = e
+	}
+	e.expires = now.Add(2 * rule.Window)
+
+	if rule.Algorithm == SlidingWindow {
+		window := now.UnixNano() / int64(rule.Window)
+		switch {
+		case window == e.window+1:
+			e.prev, e.curr = e.curr, 0
+		case window != e.window:
+			e.prev, e.curr = 0, 0
+		}
+		e.window = window
+
+		elapsed := time.Duration(now.UnixNano() % int64(rule.Window))
+		allowed := rule.slidingWindowAllowed(e.prev, e.curr, elapsed)
+		if allowed {
+			e.curr++
+		}
+		return rule.slidingWindowResult(allowed, e.prev, e.curr, elapsed), nil
+	}
+
+	e.tokens += float64(now.Sub(e.last)) / float64(rule.perToken())
+	if burst := float64(rule.burst()); e.tokens > burst {
+		e.tokens = burst
+	}
+	e.last = now
+
+	allowed := e.tokens >= 1
+	if allowed {
+		e.tokens--
+	}
+	return rule.tokenBucketResult(allowed, e.tokens), nil
+}
+
+// sweep drops expired entries at most once a minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+var (
+	tokenBucketScript = redis.NewScript(`
+-- TIME is not deterministic, so replicate the writes rather than the script
+redis.replicate_commands()
+
+local burst = tonumber(ARGV[1])
+local per_token = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+-- the Redis clock is shared by every instance, unlike the callers' clocks
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) / per_token)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {allowed, tostring(tokens)}
+`)
+
+	slidingWindowScript = redis.NewScript(`
+-- TIME is not deterministic, so replicate the writes rather than the script
+redis.replicate_commands()
+
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local id = math.floor(now / window)
+local elapsed = now - id * window
+
+-- KEYS[1] carries a hash tag, so both windows share its cluster slot
+local curr_key = KEYS[1] .. ':' .. string.format('%d', id)
+local prev_key = KEYS[1] .. ':' .. string.format('%d', id - 1)
+
+local curr = tonumber(redis.call('GET', curr_key) or '0')
+local prev = tonumber(redis.call('GET', prev_key) or '0')
+
+local allowed = 0
+if prev * (window - elapsed) / window + curr + 1 <= limit then
+	curr = redis.call('INCR', curr_key)
+	redis.call('PEXPIRE', curr_key, window * 2)
+	allowed = 1
+end
+
+return {allowed, prev, curr, elapsed}
+`)
+)
+
+// RedisRateLimitStore keeps counters in Redis so limits are shared between
+// instances. Each take is a single Lua script call.
+type RedisRateLimitStore struct {
+	client redis.Scripter
+}
+
+// NewRedisRateLimitStore returns a store backed by client, usually a
+// *redisx.Client.
+func NewRedisRateLimitStore(client redis.Scripter) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+// Take implements RateLimitStore.
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	if rule.Algorithm == SlidingWindow {
+		// windows are picked by the Redis clock, shared by every instance
+		vals, err := slidingWindowScript.Run(ctx, s.client, []string{"{" + key + "}"},
+			rule.Limit, rule.Window.Milliseconds(),
+		).Int64Slice()
+		if err != nil {
+			return RateLimitResult{}, errors.WithStack(err)
+		}
+		elapsed := time.Duration(vals[3]) * time.Millisecond
+		return rule.slidingWindowResult(vals[0] == 1, vals[1], vals[2], elapsed), nil
+	}
+
+	vals, err := tokenBucketScript.Run(ctx, s.client, []string{key},
+		rule.burst(),
+		float64(rule.perToken())/float64(time.Millisecond),
+		(2 * rule.Window).Milliseconds(),
+	).Slice()
+	if err != nil {
+		return RateLimitResult{}, errors.WithStack(err)
+	}
+
+	allowed, _ := vals[0].(int64)
+	left, _ := vals[1].(string)
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return RateLimitResult{}, errors.WithStack(err)
+	}
+	return rule.tokenBucketResult(allowed == 1, tokens), nil
+}
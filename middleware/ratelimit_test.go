@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketResult(t *testing.T) {
+	rule := RateLimitRule{Limit: 10, Window: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		rule    RateLimitRule
+		allowed bool
+		tokens  float64
+		want    RateLimitResult
+	}{
+		{
+			name:    "allowed",
+			rule:    rule,
+			allowed: true,
+			tokens:  9,
+			want:    RateLimitResult{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second},
+		},
+		{
+			name:    "denied waits for the missing fraction",
+			rule:    rule,
+			allowed: false,
+			tokens:  0.5,
+			want:    RateLimitResult{Limit: 10, Remaining: 0, Reset: 9500 * time.Millisecond, RetryAfter: 500 * time.Millisecond},
+		},
+		{
+			name:    "burst is the limit",
+			rule:    RateLimitRule{Limit: 10, Window: 10 * time.Second, Burst: 20},
+			allowed: true,
+			tokens:  19,
+			want:    RateLimitResult{Allowed: true, Limit: 20, Remaining: 19, Reset: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.tokenBucketResult(tt.allowed, tt.tokens); got != tt.want {
+				t.Errorf("tokenBucketResult(%v, %v) = %+v, want %+v", tt.allowed, tt.tokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowAllowed(t *testing.T) {
+	rule := RateLimitRule{Algorithm: SlidingWindow, Limit: 10, Window: 10 * time.Second}
+
+	tests := []struct {
+		name       string
+		prev, curr int64
+		elapsed    time.Duration
+		want       bool
+	}{
+		{name: "last request of the window", curr: 9, want: true},
+		{name: "window full", curr: 10, want: false},
+		{name: "previous window half weighted", prev: 10, elapsed: 5 * time.Second, want: true},
+		{name: "previous window half weighted, full", prev: 10, curr: 4, elapsed: 5 * time.Second, want: true},
+		{name: "previous window half weighted, over", prev: 10, curr: 5, elapsed: 5 * time.Second, want: false},
+		{name: "previous window fully weighted", prev: 10, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.slidingWindowAllowed(tt.prev, tt.curr, tt.elapsed); got != tt.want {
+				t.Errorf("slidingWindowAllowed(%d, %d, %v) = %v, want %v", tt.prev, tt.curr, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowResult(t *testing.T) {
+	rule := RateLimitRule{Algorithm: SlidingWindow, Limit: 10, Window: 10 * time.Second}
+
+	tests := []struct {
+		name       string
+		allowed    bool
+		prev, curr int64
+		elapsed    time.Duration
+		want       RateLimitResult
+	}{
+		{
+			name:    "allowed",
+			allowed: true,
+			prev:    4,
+			curr:    3,
+			elapsed: 5 * time.Second,
+			want:    RateLimitResult{Allowed: true, Limit: 10, Remaining: 5, Reset: 5 * time.Second},
+		},
+		{
+			name:    "current window full waits for the next",
+			curr:    10,
+			elapsed: 2 * time.Second,
+			want:    RateLimitResult{Limit: 10, Reset: 8 * time.Second, RetryAfter: 8 * time.Second},
+		},
+		{
+			name:    "waits for the previous window to fade",
+			prev:    10,
+			curr:    5,
+			elapsed: 5 * time.Second,
+			want:    RateLimitResult{Limit: 10, Reset: 5 * time.Second, RetryAfter: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.slidingWindowResult(tt.allowed, tt.prev, tt.curr, tt.elapsed); got != tt.want {
+				t.Errorf("slidingWindowResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      RateLimitRule
+		remaining []int
+	}{
+		{
+			name:      "token bucket",
+			rule:      RateLimitRule{Algorithm: TokenBucket, Limit: 3, Window: time.Hour},
+			remaining: []int{2, 1, 0},
+		},
+		{
+			name:      "sliding window",
+			rule:      RateLimitRule{Algorithm: SlidingWindow, Limit: 3, Window: time.Hour},
+			remaining: []int{2, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewMemoryRateLimitStore()
+
+			for i, want := range tt.remaining {
+				res, err := s.Take(ctx, "a", tt.rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !res.Allowed || res.Remaining != want {
+					t.Fatalf("take %d = %+v, want allowed with %d remaining", i+1, res, want)
+				}
+			}
+
+			res, err := s.Take(ctx, "a", tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed || res.RetryAfter <= 0 {
+				t.Errorf("take over limit = %+v, want denied with a retry after", res)
+			}
+
+			// keys are counted apart
+			if res, _ := s.Take(ctx, "b", tt.rule); !res.Allowed {
+				t.Errorf("take of another key = %+v, want allowed", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StackFrame is one frame of a panic stack trace.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// PanicAlert describes a recovered panic sent to alert hooks.
+type PanicAlert struct {
+	Time      time.Time    `json:"time"`
+	RequestID string       `json:"request_id"`
+	Method    string       `json:"method"`
+	Route     string       `json:"route"`
+	Path      string       `json:"path"`
+	Error     string       `json:"error"`
+	Stack     []StackFrame `json:"stack,omitempty"`
+
+	// Suppressed counts panics not alerted since the previous alert.
+	Suppressed int `json:"suppressed"`
+}
+
+// PanicAlertHook is notified of recovered panics.
+type PanicAlertHook interface {
+	Alert(ctx context.Context, alert *PanicAlert) error
+}
+
+// PanicAlertHookFunc adapts a function to PanicAlertHook.
+type PanicAlertHookFunc func(ctx context.Context, alert *PanicAlert) error
+
+// Alert calls f(ctx, alert).
+func (f PanicAlertHookFunc) Alert(ctx context.Context, alert *PanicAlert) error {
+	return f(ctx, alert)
+}
+
+// WebhookPanicAlert posts alerts as JSON to url.
+func WebhookPanicAlert(url string, client *http.Client) PanicAlertHook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return PanicAlertHookFunc(func(ctx context.Context, alert *PanicAlert) error {
+		b, err := json.Marshal(alert)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+		res, err := client.Do(req)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode >= http.StatusBadRequest {
+			return errors.Errorf("panic alert webhook status %s", res.Status)
+		}
+		return nil
+	})
+}
+
+// PubSubPanicAlert publishes alerts to topicID, e.g. with a *pubsubx.Pub.
+func PubSubPanicAlert(pub interface {
+	Publish(ctx context.Context, topicID string, i interface{}) error
+}, topicID string) PanicAlertHook {
+	return PanicAlertHookFunc(func(ctx context.Context, alert *PanicAlert) error {
+		return pub.Publish(ctx, topicID, alert)
+	})
+}
+
+// RecoverAlertConfig defines the config for RecoverWithAlerts middleware.
+type RecoverAlertConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default never skips.
+	Skipper Skipper
+
+	// MaxFrames is the maximum number of stack frames recorded.
+	// Default is 32.
+	MaxFrames int
+
+	// DisablePrintStack leaves the stack out of the log entry.
+	DisablePrintStack bool
+
+	// Response writes the response for a recovered panic.
+	// Default hands err to the HTTPErrorHandler.
+	Response func(c echo.Context, err error) error
+
+	// Alerts are notified of panics, asynchronously.
+	Alerts []PanicAlertHook
+
+	// AlertInterval is the minimum time between two alerts; panics in
+	// between are counted in the next alert's Suppressed.
+	// Default is 1 minute.
+	AlertInterval time.Duration
+
+	// AlertTimeout bounds a single alert hook call.
+	// Default is 10 seconds.
+	AlertTimeout time.Duration
+}
+
+var (
+	// DefaultRecoverAlertConfig is the default RecoverWithAlerts middleware
+	// config.
+	DefaultRecoverAlertConfig = RecoverAlertConfig{
+		Skipper:       func(echo.Context) bool { return false },
+		MaxFrames:     32,
+		AlertInterval: time.Minute,
+		AlertTimeout:  10 * time.Second,
+	}
+)
+
+// Recover returns a middleware which recovers from panics anywhere in the chain
+// and handles the control to the centralized HTTPErrorHandler.
+func Recover() echo.MiddlewareFunc {
+	return RecoverWithConfig(middleware.DefaultRecoverConfig)
+}
+
+// RecoverWithConfig returns a Recover middleware with config. The panic is
+// logged at emergency severity with structured stack frames of the panicking
+// goroutine, up to DefaultRecoverAlertConfig.MaxFrames, so StackSize and
+// DisableStackAll are ignored. Use RecoverWithAlerts for alert hooks and a
+// custom response.
+func RecoverWithConfig(config middleware.RecoverConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultRecoverConfig.Skipper
+	}
+
+	return RecoverWithAlerts(RecoverAlertConfig{
+		Skipper:           Skipper(config.Skipper),
+		DisablePrintStack: config.DisablePrintStack,
+	})
+}
+
+// RecoverWithAlerts returns a middleware which recovers from panics like
+// Recover and also notifies config.Alerts.
+func RecoverWithAlerts(config RecoverAlertConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultRecoverAlertConfig.Skipper
+	}
+	if config.MaxFrames == 0 {
+		config.MaxFrames = DefaultRecoverAlertConfig.MaxFrames
+	}
+	if config.AlertInterval == 0 {
+		config.AlertInterval = DefaultRecoverAlertConfig.AlertInterval
+	}
+	if config.AlertTimeout == 0 {
+		config.AlertTimeout = DefaultRecoverAlertConfig.AlertTimeout
+	}
+
+	limiter := &alertLimiter{interval: config.AlertInterval}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					err, ok := r.(error)
+					if !ok {
+						err = fmt.Errorf("%v", r)
+					}
+					ctx := c.Request().Context()
+					frames := stackFrames(4, config.MaxFrames)
+
+					fields := logrus.Fields{
+						"error":  err.Error(),
+						"method": c.Request().Method,
+						"route":  c.Path(),
+					}
+					if !config.DisablePrintStack {
+						fields["stack"] = frames
+					}
+					logx.WithSeverityEmergency(ctx).WithFields(fields).Error("[PANIC RECOVER]")
+					recordPanic(trace.SpanFromContext(ctx), r)
+
+					if len(config.Alerts) > 0 {
+						if suppressed, ok := limiter.allow(); ok {
+							config.alert(ctx, &PanicAlert{
+								Time:       time.Now(),
+								RequestID:  contextx.GetID(ctx),
+								Method:     c.Request().Method,
+								Route:      c.Path(),
+								Path:       c.Request().URL.Path,
+								Error:      err.Error(),
+								Stack:      frames,
+								Suppressed: suppressed,
+							})
+						}
+					}
+
+					if config.Response == nil {
+						c.Error(err)
+						return
+					}
+					if rerr := config.Response(c, err); rerr != nil {
+						c.Error(rerr)
+					}
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// alert runs the hooks in the background so a slow hook never holds the
+// request.
+func (config RecoverAlertConfig) alert(ctx context.Context, alert *PanicAlert) {
+	id := contextx.GetID(ctx)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(contextx.SetID(context.Background(), id), config.AlertTimeout)
+		defer cancel()
+
+		for _, hook := range config.Alerts {
+			if err := hook.Alert(ctx, alert); err != nil {
+				logx.WithSeverityError(ctx).WithField("error", err).Error("panic alert error")
+			}
+		}
+	}()
+}
+
+// stackFrames returns up to max frames of the calling goroutine, skipping
+// the first skip callers.
+func stackFrames(skip, max int) []StackFrame {
+	pcs := make([]uintptr, max)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	out := make([]StackFrame, 0, n)
+	for {
+		f, more := frames.Next()
+		out = append(out, StackFrame{
+			Function: f.Function,
+			File:     f.File,
+			Line:     f.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// alertLimiter lets one alert through per interval and counts the rest.
+type alertLimiter struct {
+	interval time.Duration
+
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+func (l *alertLimiter) allow() (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.last) < l.interval {
+		l.suppressed++
+		return 0, false
+	}
+
+	suppressed := l.suppressed
+	l.last = time.Now()
+	l.suppressed = 0
+	return suppressed, true
+}
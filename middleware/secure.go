@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Security headers not defined by echo.
+const (
+	HeaderReferrerPolicy    = "Referrer-Policy"
+	HeaderPermissionsPolicy = "Permissions-Policy"
+)
+
+// SecureConfig defines the config for Secure middleware. It can be loaded
+// from viper, e.g. viperx.UnmarshalKey(ctx, "http.secure", &config).
+type SecureConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper `mapstructure:"-"`
+
+	// XSSProtection is the X-XSS-Protection header value.
+	XSSProtection string `mapstructure:"xss_protection"`
+
+	// ContentTypeNosniff is the X-Content-Type-Options header value.
+	ContentTypeNosniff string `mapstructure:"content_type_nosniff"`
+
+	// XFrameOptions is the X-Frame-Options header value.
+	XFrameOptions string `mapstructure:"x_frame_options"`
+
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds,
+	// sent on TLS requests only. Zero omits the header.
+	HSTSMaxAge            int  `mapstructure:"hsts_max_age"`
+	HSTSIncludeSubdomains bool `mapstructure:"hsts_include_subdomains"`
+	HSTSPreload           bool `mapstructure:"hsts_preload"`
+
+	// ContentSecurityPolicy is the Content-Security-Policy header value.
+	ContentSecurityPolicy string `mapstructure:"content_security_policy"`
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool `mapstructure:"csp_report_only"`
+
+	// ReferrerPolicy is the Referrer-Policy header value.
+	ReferrerPolicy string `mapstructure:"referrer_policy"`
+
+	// PermissionsPolicy is the Permissions-Policy header value.
+	PermissionsPolicy string `mapstructure:"permissions_policy"`
+}
+
+var (
+	// DefaultSecureConfig is the default Secure middleware config.
+	DefaultSecureConfig = SecureConfig{
+		Skipper:            DefaultSkipper,
+		XSSProtection:      "1; mode=block",
+		ContentTypeNosniff: "nosniff",
+		XFrameOptions:      "SAMEORIGIN",
+	}
+)
+
+// Secure returns a middleware setting security headers.
+func Secure() echo.MiddlewareFunc {
+	return SecureWithConfig(DefaultSecureConfig)
+}
+
+// SecureWithConfig returns a Secure middleware with config. Empty values
+// omit their header.
+func SecureWithConfig(config SecureConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultSecureConfig.Skipper
+	}
+
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", config.HSTSMaxAge)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubdomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	csp := echo.HeaderContentSecurityPolicy
+	if config.CSPReportOnly {
+		csp = echo.HeaderContentSecurityPolicyReportOnly
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			setHeader(h, echo.HeaderXXSSProtection, config.XSSProtection)
+			setHeader(h, echo.HeaderXContentTypeOptions, config.ContentTypeNosniff)
+			setHeader(h, echo.HeaderXFrameOptions, config.XFrameOptions)
+			setHeader(h, csp, config.ContentSecurityPolicy)
+			setHeader(h, HeaderReferrerPolicy, config.ReferrerPolicy)
+			setHeader(h, HeaderPermissionsPolicy, config.PermissionsPolicy)
+			if c.IsTLS() || c.Request().Header.Get(echo.HeaderXForwardedProto) == "https" {
+				setHeader(h, echo.HeaderStrictTransportSecurity, hsts)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func setHeader(h http.Header, key, value string) {
+	if value != "" {
+		h.Set(key, value)
+	}
+}
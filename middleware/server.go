@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// ServerConfig defines the config for Server.
+type ServerConfig struct {
+	// Address to listen on, e.g. ":8080".
+	Address string
+
+	// http.Server timeouts. Zero leaves the echo server's value.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// Health is marked not ready when shutdown starts, so load balancers
+	// stop routing new requests during DrainPeriod.
+	Health *HealthRegistry
+
+	// DrainPeriod to wait after failing readiness before shutting down.
+	// Default is 5 seconds.
+	DrainPeriod time.Duration
+
+	// ShutdownTimeout bounds the whole shutdown, from the signal to the
+	// last closer. Default is 30 seconds.
+	ShutdownTimeout time.Duration
+
+	// Signals that start shutdown.
+	// Default is SIGINT and SIGTERM.
+	Signals []os.Signal
+}
+
+var (
+	// DefaultServerConfig is the default Server config.
+	DefaultServerConfig = ServerConfig{
+		Address:         ":8080",
+		DrainPeriod:     5 * time.Second,
+		ShutdownTimeout: 30 * time.Second,
+		Signals:         []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+)
+
+// Server runs an echo instance and shuts it down gracefully.
+type Server struct {
+	echo    *echo.Echo
+	config  ServerConfig
+	closers []serverCloser
+}
+
+type serverCloser struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+// NewServer returns a Server running e.
+func NewServer(e *echo.Echo, config ServerConfig) *Server {
+	// Defaults
+	if config.Address == "" {
+		config.Address = DefaultServerConfig.Address
+	}
+	if config.DrainPeriod == 0 {
+		config.DrainPeriod = DefaultServerConfig.DrainPeriod
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultServerConfig.ShutdownTimeout
+	}
+	if len(config.Signals) == 0 {
+		config.Signals = DefaultServerConfig.Signals
+	}
+
+	return &Server{
+		echo:   e,
+		config: config,
+	}
+}
+
+// OnShutdown registers fn to run after the server stopped. Functions run in
+// reverse registration order, so register dependencies first.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.closers = append(s.closers, serverCloser{name: name, close: fn})
+}
+
+// AddCloser registers c, e.g. a redisx.Client, sarama.SyncProducer,
+// pubsub.Client or sql.DB, to be closed after the server stopped.
+func (s *Server) AddCloser(name string, c io.Closer) {
+	s.OnShutdown(name, func(context.Context) error {
+		return c.Close()
+	})
+}
+
+// Run starts the server and blocks until it failed or a signal shut it
+// down. It returns the first error met.
+func (s *Server) Run() error {
+	srv := s.echo.Server
+	if s.config.ReadTimeout != 0 {
+		srv.ReadTimeout = s.config.ReadTimeout
+	}
+	if s.config.ReadHeaderTimeout != 0 {
+		srv.ReadHeaderTimeout = s.config.ReadHeaderTimeout
+	}
+	if s.config.WriteTimeout != 0 {
+		srv.WriteTimeout = s.config.WriteTimeout
+	}
+	if s.config.IdleTimeout != 0 {
+		srv.IdleTimeout = s.config.IdleTimeout
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, s.config.Signals...)
+	defer signal.Stop(sig)
+
+	errc := make(chan error, 1)
+	go func() {
+		logx.WithField("address", s.config.Address).Info("server starting")
+		if err := s.echo.Start(s.config.Address); err != nil && err != http.ErrServerClosed {
+			errc <- err
+		}
+	}()
+
+	var runErr error
+	select {
+	case err := <-errc:
+		logx.WithField("error", err).Error("server failed")
+		runErr = errors.WithStack(err)
+	case got := <-sig:
+		logx.WithField("signal", got.String()).Info("server shutdown signal received")
+	}
+
+	if err := s.Shutdown(); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// Shutdown drains and stops the server, then runs the closers.
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	if s.config.Health != nil {
+		s.config.Health.SetReady(false)
+		logx.WithField("drain_period", s.config.DrainPeriod.String()).Info("server draining")
+
+		select {
+		case <-time.After(s.config.DrainPeriod):
+		case <-ctx.Done():
+		}
+	}
+
+	var firstErr error
+	start := time.Now()
+	err := s.echo.Shutdown(ctx)
+	logShutdownStep("echo", start, err)
+	if err != nil {
+		firstErr = errors.WithStack(err)
+	}
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		c := s.closers[i]
+
+		start := time.Now()
+		err := runCloser(ctx, c)
+		logShutdownStep(c.name, start, err)
+		if err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+
+	return firstErr
+}
+
+// runCloser runs c, giving up when ctx is done.
+func runCloser(ctx context.Context, c serverCloser) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.close(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func logShutdownStep(name string, start time.Time, err error) {
+	log := logx.WithFields(logrus.Fields{
+		"step":     name,
+		"duration": time.Since(start).String(),
+	})
+	if err != nil {
+		log.WithField("error", err).Error("server shutdown step failed")
+		return
+	}
+	log.Info("server shutdown step done")
+}
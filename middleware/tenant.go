@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/httpx"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// TenantExtractor returns the tenant ID of a request, or "" when it carries
+// none.
+type TenantExtractor func(c echo.Context) string
+
+// TenantFromHeader reads the tenant ID from header.
+func TenantFromHeader(header string) TenantExtractor {
+	return func(c echo.Context) string {
+		return strings.TrimSpace(c.Request().Header.Get(header))
+	}
+}
+
+// TenantFromSubdomain reads the tenant ID from the first label of hosts
+// under domain, e.g. "acme" for "acme.example.com" with domain
+// "example.com".
+func TenantFromSubdomain(domain string) TenantExtractor {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(domain, "."))
+
+	return func(c echo.Context) string {
+		host := strings.ToLower(c.Request().Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return ""
+		}
+
+		sub := strings.TrimSuffix(host, suffix)
+		if strings.Contains(sub, ".") {
+			return ""
+		}
+		return sub
+	}
+}
+
+// TenantFromClaim reads the tenant ID from a string claim of the principal,
+// so it must run after JWTWithConfig.
+func TenantFromClaim(claim string) TenantExtractor {
+	return func(c echo.Context) string {
+		p, ok := contextx.GetPrincipal(c.Request().Context())
+		if !ok {
+			return ""
+		}
+		s, _ := p.Claims[claim].(string)
+		return s
+	}
+}
+
+// TenantRegistry knows which tenants exist.
+type TenantRegistry interface {
+	Exists(ctx context.Context, tenant string) (bool, error)
+}
+
+// TenantRegistryFunc adapts a function to TenantRegistry.
+type TenantRegistryFunc func(ctx context.Context, tenant string) (bool, error)
+
+// Exists calls f(ctx, tenant).
+func (f TenantRegistryFunc) Exists(ctx context.Context, tenant string) (bool, error) {
+	return f(ctx, tenant)
+}
+
+// StaticTenantRegistry accepts a fixed set of tenants.
+func StaticTenantRegistry(tenants ...string) TenantRegistry {
+	set := make(map[string]struct{}, len(tenants))
+	for _, t := range tenants {
+		set[t] = struct{}{}
+	}
+
+	return TenantRegistryFunc(func(ctx context.Context, tenant string) (bool, error) {
+		_, ok := set[tenant]
+		return ok, nil
+	})
+}
+
+// TenantConfig defines the config for Tenant middleware.
+type TenantConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Extractors are tried in order; the first tenant ID found wins.
+	// Default reads the X-Tenant-ID header.
+	Extractors []TenantExtractor
+
+	// Registry validates tenant IDs. Nil accepts any tenant.
+	Registry TenantRegistry
+
+	// CacheTTL is how long registry answers, positive or negative, are
+	// cached. Default is 1 minute.
+	CacheTTL time.Duration
+
+	// CacheSize is the maximum number of tenant IDs cached.
+	// Default is 10000.
+	CacheSize int
+
+	// Optional lets requests without a tenant through.
+	Optional bool
+}
+
+var (
+	// DefaultTenantConfig is the default Tenant middleware config.
+	DefaultTenantConfig = TenantConfig{
+		Skipper:   DefaultSkipper,
+		CacheTTL:  time.Minute,
+		CacheSize: 10000,
+	}
+)
+
+// Tenant returns a middleware resolving the tenant ID from the X-Tenant-ID
+// header and validating it against registry.
+func Tenant(registry TenantRegistry) echo.MiddlewareFunc {
+	config := DefaultTenantConfig
+	config.Registry = registry
+	return TenantWithConfig(config)
+}
+
+// TenantWithConfig returns a Tenant middleware with config. The tenant is
+// stored with contextx.SetTenant, so logx lines and httpx requests made with
+// the request context carry it.
+func TenantWithConfig(config TenantConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultTenantConfig.Skipper
+	}
+	if len(config.Extractors) == 0 {
+		config.Extractors = []TenantExtractor{TenantFromHeader(httpx.HeaderXTenantID)}
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = DefaultTenantConfig.CacheTTL
+	}
+	if config.CacheSize == 0 {
+		config.CacheSize = DefaultTenantConfig.CacheSize
+	}
+
+	cache := newLookupCache(config.CacheSize, config.CacheTTL)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := req.Context()
+
+			tenant := ""
+			for _, extract := range config.Extractors {
+				if tenant = extract(c); tenant != "" {
+					break
+				}
+			}
+
+			if tenant == "" {
+				if config.Optional {
+					return next(c)
+				}
+				return WriteProblem(c, http.StatusBadRequest, NewProblem(c, http.StatusBadRequest, "tenant required"))
+			}
+
+			if config.Registry != nil {
+				exists, err := cache.get(ctx, tenant, func(ctx context.Context) (interface{}, error) {
+					return config.Registry.Exists(ctx, tenant)
+				})
+				if err != nil {
+					return err
+				}
+				if !exists.(bool) {
+					logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+						"tenant": tenant,
+						"route":  c.Path(),
+						"method": req.Method,
+					}).Warn("unknown tenant")
+					return WriteProblem(c, http.StatusForbidden, NewProblem(c, http.StatusForbidden, "unknown tenant"))
+				}
+			}
+
+			c.SetRequest(req.WithContext(contextx.SetTenant(ctx, tenant)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// TimeoutConfig defines the config for Timeout middleware.
+type TimeoutConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// Timeout is the deadline put on the request context.
+	Timeout time.Duration
+
+	// Status written when the deadline fires.
+	// Default is 503 Service Unavailable.
+	Status int
+
+	// Message is the problem detail written when the deadline fires.
+	Message string
+}
+
+var (
+	// DefaultTimeoutConfig is the default Timeout middleware config.
+	DefaultTimeoutConfig = TimeoutConfig{
+		Skipper: DefaultSkipper,
+		Status:  http.StatusServiceUnavailable,
+		Message: "request timed out",
+	}
+)
+
+// Timeout returns a middleware that cancels the request context after d.
+// Use it on a route group to give the group its own deadline.
+func Timeout(d time.Duration) echo.MiddlewareFunc {
+	config := DefaultTimeoutConfig
+	config.Timeout = d
+	return TimeoutWithConfig(config)
+}
+
+// TimeoutWithConfig returns a Timeout middleware with config.
+//
+// The handler keeps running on the request goroutine until it returns, so it
+// should honour the context; calls made through httpx, redisx and gorm do.
+// When the deadline fires before anything was written, the complete problem
+// response, with its Content-Length, is written and flushed at once, so the
+// client is answered on time; later handler writes are discarded.
+func TimeoutWithConfig(config TimeoutConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultTimeoutConfig.Skipper
+	}
+	if config.Status == 0 {
+		config.Status = DefaultTimeoutConfig.Status
+	}
+	if config.Message == "" {
+		config.Message = DefaultTimeoutConfig.Message
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || config.Timeout <= 0 {
+				return next(c)
+			}
+
+			req := c.Request()
+			res := c.Response()
+
+			ctx, cancel := context.WithTimeout(req.Context(), config.Timeout)
+			defer cancel()
+			c.SetRequest(req.WithContext(ctx))
+
+			body, _ := json.Marshal(NewProblem(c, config.Status, config.Message))
+			tw := &timeoutWriter{ResponseWriter: res.Writer, header: make(http.Header)}
+			for k, v := range res.Writer.Header() {
+				tw.header[k] = v
+			}
+			res.Writer = tw
+
+			timer := time.AfterFunc(config.Timeout, func() {
+				tw.timeout(config.Status, body)
+			})
+
+			err := next(c)
+
+			timer.Stop()
+			if !tw.finish() {
+				return err
+			}
+
+			logx.WithSeverityWarn(ctx).WithFields(logrus.Fields{
+				"route":   c.Path(),
+				"method":  req.Method,
+				"timeout": config.Timeout.String(),
+				"error":   err,
+			}).Warn("echo request timeout")
+
+			// the timeout response replaced whatever the handler wrote
+			res.Status = config.Status
+			res.Committed = true
+			return nil
+		}
+	}
+}
+
+// timeoutWriter serialises handler writes with the timeout response. The
+// handler writes to its own header map so the timer never races with it.
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	mu          sync.Mutex
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+	done        bool
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+	w.writeHeader(code)
+}
+
+func (w *timeoutWriter) writeHeader(code int) {
+	w.wroteHeader = true
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !w.wroteHeader {
+		w.writeHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection to the handler, e.g. for websockets, which
+// takes it out of the timeout.
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("echo: response writer does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// timeout writes the timeout response unless the handler already started its
+// own or has returned.
+func (w *timeoutWriter) timeout(status int, body []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.done || w.wroteHeader {
+		return
+	}
+	w.timedOut = true
+
+	// Content-Length lets the client read the whole response while the
+	// handler is still running
+	h := w.ResponseWriter.Header()
+	h.Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	h.Set(echo.HeaderContentLength, strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(body)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish stops further timeouts and reports whether one was written.
+func (w *timeoutWriter) finish() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.done = true
+	if !w.timedOut && !w.wroteHeader {
+		dst := w.ResponseWriter.Header()
+		for k, v := range w.header {
+			dst[k] = v
+		}
+	}
+	return w.timedOut
+}
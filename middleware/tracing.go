@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tOnkowzl/libs/contextx"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/tOnkowzl/libs/middleware"
+
+// TracingConfig defines the config for Tracing middleware.
+type TracingConfig struct {
+	// Skipper defines a function to skip middleware.
+	// Default is DefaultSkipper.
+	Skipper Skipper
+
+	// TracerProvider creates the server spans.
+	// Default is otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+
+	// Propagators extract the incoming trace context.
+	// Default accepts W3C traceparent, baggage and B3 headers.
+	Propagators propagation.TextMapPropagator
+}
+
+var (
+	// DefaultTracingConfig is the default Tracing middleware config.
+	DefaultTracingConfig = TracingConfig{
+		Skipper: DefaultSkipper,
+		Propagators: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+			b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader|b3.B3SingleHeader)),
+		),
+	}
+)
+
+// Tracing returns an OpenTelemetry server tracing middleware.
+func Tracing() echo.MiddlewareFunc {
+	return TracingWithConfig(DefaultTracingConfig)
+}
+
+// TracingWithConfig returns a Tracing middleware with config.
+func TracingWithConfig(config TracingConfig) echo.MiddlewareFunc {
+	// Defaults
+	if config.Skipper == nil {
+		config.Skipper = DefaultTracingConfig.Skipper
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+	if config.Propagators == nil {
+		config.Propagators = DefaultTracingConfig.Propagators
+	}
+
+	tracer := config.TracerProvider.Tracer(tracerName)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := config.Propagators.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			name := c.Path()
+			if name == "" {
+				name = req.Method
+			}
+
+			ctx, span := tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.method", req.Method),
+					attribute.String("http.route", c.Path()),
+					attribute.String("http.target", req.RequestURI),
+					attribute.String("http.host", req.Host),
+					attribute.String("http.client_ip", c.RealIP()),
+				),
+			)
+			defer span.End()
+
+			sc := span.SpanContext()
+			ctx = contextx.SetTraceID(ctx, sc.TraceID().String())
+			ctx = contextx.SetSpanID(ctx, sc.SpanID().String())
+			if contextx.GetID(ctx) == "" {
+				ctx = contextx.SetID(ctx, sc.TraceID().String())
+			}
+			span.SetAttributes(attribute.String("request.id", contextx.GetID(ctx)))
+			c.SetRequest(req.WithContext(ctx))
+
+			defer func() {
+				if r := recover(); r != nil {
+					recordPanic(span, r)
+					panic(r)
+				}
+			}()
+
+			err = next(c)
+
+			status := responseStatus(c, err)
+			span.SetAttributes(attribute.Int("http.status_code", status))
+			if err != nil {
+				span.RecordError(err)
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
+
+// recordPanic marks span as failed by a recovered panic value r.
+func recordPanic(span trace.Span, r interface{}) {
+	err, ok := r.(error)
+	if !ok {
+		err = fmt.Errorf("%v", r)
+	}
+	span.RecordError(err, trace.WithAttributes(attribute.Bool("panic", true)))
+	span.SetStatus(codes.Error, "panic: "+err.Error())
+}
@@ -0,0 +1,186 @@
+package redisx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes values stored in Redis.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codecs.
+var (
+	JSON     Codec = jsonCodec{}
+	MsgPack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	return b, errors.WithStack(err)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return errors.WithStack(json.Unmarshal(data, v))
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := msgpack.Marshal(v)
+	return b, errors.WithStack(err)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return errors.WithStack(msgpack.Unmarshal(data, v))
+}
+
+// protobufCodec only handles proto.Message values.
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("redisx: %T is not a proto.Message", v)
+	}
+	b, err := proto.Marshal(m)
+	return b, errors.WithStack(err)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	// GetT[*pb.Foo] passes a **pb.Foo
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		v = rv.Elem().Interface()
+	}
+
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("redisx: %T is not a proto.Message", v)
+	}
+	return errors.WithStack(proto.Unmarshal(data, m))
+}
+
+// Gzip wraps codec, compressing what it encodes at gzip level.
+func Gzip(codec Codec, level int) Codec {
+	return gzipCodec{codec: codec, level: level}
+}
+
+type gzipCodec struct {
+	codec Codec
+	level int
+}
+
+func (g gzipCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := g.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, g.level)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (g gzipCodec) Unmarshal(data []byte, v interface{}) error {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return g.codec.Unmarshal(b, v)
+}
+
+// codec returns the client codec, JSON by default.
+func (c *Client) codec() Codec {
+	if c.Codec == nil {
+		return JSON
+	}
+	return c.Codec
+}
+
+// encodeArg encodes v with the client codec unless go-redis writes it
+// natively, so structs and maps are not stored as their fmt form. Native
+// values are stored as go-redis formats them, whatever the codec, so they
+// stay readable by other clients; Bind parses them back with isNativeDest.
+func (c *Client) encodeArg(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case nil, string, []byte, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64, bool,
+		time.Time, encoding.BinaryMarshaler:
+		return v, nil
+	}
+	return c.codec().Marshal(v)
+}
+
+// isNativeDest reports whether v points to a type encodeArg stores natively.
+func isNativeDest(v interface{}) bool {
+	switch v.(type) {
+	case *string, *[]byte, *int, *int8, *int16, *int32, *int64,
+		*uint, *uint8, *uint16, *uint32, *uint64, *float32, *float64, *bool,
+		*time.Time, encoding.BinaryUnmarshaler:
+		return true
+	}
+	return false
+}
+
+// encodeHashArgs encodes the values of HSet arguments, given as field value
+// pairs or as a single map.
+func (c *Client) encodeHashArgs(values []interface{}) ([]interface{}, error) {
+	if len(values) == 1 {
+		m, ok := values[0].(map[string]interface{})
+		if !ok {
+			return values, nil
+		}
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			ev, err := c.encodeArg(v)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = ev
+		}
+		return []interface{}{out}, nil
+	}
+
+	out := make([]interface{}, len(values))
+	copy(out, values)
+	for i := 1; i < len(out); i += 2 {
+		ev, err := c.encodeArg(out[i])
+		if err != nil {
+			return nil, err
+		}
+		out[i] = ev
+	}
+	return out, nil
+}
@@ -0,0 +1,189 @@
+package redisx
+
+import (
+	"compress/gzip"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testUser struct {
+	Name  string   `json:"name" msgpack:"name"`
+	Age   int      `json:"age" msgpack:"age"`
+	Roles []string `json:"roles" msgpack:"roles"`
+}
+
+// newTestClient returns a client of an in-process Redis server.
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	c := NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c, mr
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codecs := []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSON},
+		{"msgpack", MsgPack},
+		{"gzip json", Gzip(JSON, gzip.BestSpeed)},
+		{"gzip msgpack", Gzip(MsgPack, gzip.DefaultCompression)},
+	}
+
+	in := testUser{Name: "a", Age: 42, Roles: []string{"admin"}}
+	for _, tt := range codecs {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.codec.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out testUser
+			if err := tt.codec.Unmarshal(b, &out); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, in) {
+				t.Errorf("round trip = %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	b, err := Protobuf.Marshal(wrapperspb.String("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// GetT[*wrapperspb.StringValue] passes a pointer to a nil message
+	var out *wrapperspb.StringValue
+	if err := Protobuf.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(out, wrapperspb.String("hello")) {
+		t.Errorf("round trip = %v, want hello", out)
+	}
+
+	if _, err := Protobuf.Marshal(testUser{}); err == nil {
+		t.Error("Marshal of a non proto.Message succeeded")
+	}
+}
+
+func TestBind(t *testing.T) {
+	at := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	user := testUser{Name: "a", Age: 42}
+	packed, _ := msgpack.Marshal(user)
+
+	tests := []struct {
+		name string
+		bind *Bind
+		dest interface{}
+		want interface{}
+	}{
+		{"msgpack native int", &Bind{Val: "42", codec: MsgPack}, new(int), 42},
+		{"json native string", &Bind{Val: "hello", codec: JSON}, new(string), "hello"},
+		{"native bool", &Bind{Val: "1", codec: JSON}, new(bool), true},
+		{"native time", &Bind{Val: at.Format(time.RFC3339Nano), codec: MsgPack}, new(time.Time), at},
+		{"json struct", &Bind{Val: `{"name":"a","age":42}`, codec: JSON}, new(testUser), user},
+		{"msgpack struct", &Bind{Val: string(packed), codec: MsgPack}, new(testUser), user},
+		{"remember value is json", &Bind{Val: `"hello"`}, new(string), "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.bind.Bind(tt.dest); err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(tt.dest).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetGetRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	user := testUser{Name: "a", Age: 42, Roles: []string{"admin"}}
+
+	tests := []struct {
+		name  string
+		codec Codec
+		value interface{}
+		dest  interface{}
+	}{
+		{"json int", JSON, 42, new(int)},
+		{"json string", JSON, "hello", new(string)},
+		{"json struct", JSON, user, new(testUser)},
+		{"msgpack int", MsgPack, 42, new(int)},
+		{"msgpack string", MsgPack, "hello", new(string)},
+		{"msgpack struct", MsgPack, user, new(testUser)},
+		{"gzip struct", Gzip(JSON, gzip.BestSpeed), user, new(testUser)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t)
+			c.Codec = tt.codec
+
+			if err := c.Set(ctx, "k", tt.value, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Get(ctx, "k").Bind(tt.dest); err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(tt.dest).Elem().Interface(); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("Get after Set = %#v, want %#v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestSetTGetT(t *testing.T) {
+	ctx := context.Background()
+	user := testUser{Name: "a", Age: 42, Roles: []string{"admin"}}
+
+	for _, codec := range []Codec{JSON, MsgPack, Gzip(MsgPack, gzip.BestSpeed)} {
+		c, _ := newTestClient(t)
+		c.Codec = codec
+
+		if err := SetT(ctx, c, "user", user, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetT[testUser](ctx, c, "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, user) {
+			t.Errorf("GetT = %+v, want %+v", got, user)
+		}
+
+		// SetT encodes native values too, so GetT reads them back typed
+		if err := SetT(ctx, c, "n", 42, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := GetT[int](ctx, c, "n"); err != nil || n != 42 {
+			t.Errorf("GetT[int] = %v, %v, want 42", n, err)
+		}
+
+		if err := HSetT(ctx, c, "users", map[string]testUser{"a": user}); err != nil {
+			t.Fatal(err)
+		}
+		all, err := HGetAllT[testUser](ctx, c, "users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(all, map[string]testUser{"a": user}) {
+			t.Errorf("HGetAllT = %+v", all)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package redisx
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GetT decodes the value at key with the client codec. Store it with SetT.
+func GetT[T any](ctx context.Context, c *Client, key string) (T, error) {
+	var v T
+	b := c.Get(ctx, key)
+	if b.Err != nil {
+		return v, b.Err
+	}
+	err := c.codec().Unmarshal([]byte(b.Val), &v)
+	return v, err
+}
+
+// SetT encodes value with the client codec, whatever its type.
+func SetT[T any](ctx context.Context, c *Client, key string, value T, expiration time.Duration) error {
+	b, err := c.codec().Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, b, expiration)
+}
+
+// HGetT decodes field of hash key with the client codec. Store it with
+// HSetT.
+func HGetT[T any](ctx context.Context, c *Client, key, field string) (T, error) {
+	var v T
+	b := c.HGet(ctx, key, field)
+	if b.Err != nil {
+		return v, b.Err
+	}
+	err := c.codec().Unmarshal([]byte(b.Val), &v)
+	return v, err
+}
+
+// HGetAllT decodes every field of hash key with the client codec.
+func HGetAllT[T any](ctx context.Context, c *Client, key string) (map[string]T, error) {
+	m, err := c.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	out := make(map[string]T, len(m))
+	for field, val := range m {
+		var v T
+		if err := c.codec().Unmarshal([]byte(val), &v); err != nil {
+			return nil, err
+		}
+		out[field] = v
+	}
+	return out, nil
+}
+
+// HSetT encodes values with the client codec into fields of hash key.
+func HSetT[T any](ctx context.Context, c *Client, key string, values map[string]T) error {
+	args := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		b, err := c.codec().Marshal(value)
+		if err != nil {
+			return err
+		}
+		args[field] = b
+	}
+	return c.HSet(ctx, key, args)
+}
@@ -0,0 +1,325 @@
+package redisx
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Cache tiers.
+const (
+	TierLocal = "local"
+	TierRedis = "redis"
+)
+
+// LocalCacheOptions configures the in-process tier of a client.
+type LocalCacheOptions struct {
+	// Size is the maximum number of keys kept.
+	// Default is 10000.
+	Size int
+
+	// TTL bounds how long a key is served locally, which also bounds
+	// staleness when invalidations are missed during a reconnect. A key is
+	// never served past its own Redis TTL. Default is 1 minute.
+	TTL time.Duration
+
+	// Channel is the pub/sub channel invalidations are broadcast on.
+	// Default is "redisx:invalidate".
+	Channel string
+}
+
+// DefaultLocalCacheOptions are the defaults of LocalCacheOptions.
+var DefaultLocalCacheOptions = LocalCacheOptions{
+	Size:    10000,
+	TTL:     time.Minute,
+	Channel: "redisx:invalidate",
+}
+
+// CacheStats counts reads per tier.
+type CacheStats struct {
+	LocalHits   uint64
+	LocalMisses uint64
+	RedisHits   uint64
+	RedisMisses uint64
+}
+
+// NewClientWithLocalCache returns a standalone client with a local cache
+// tier, see WithLocalCache.
+func NewClientWithLocalCache(opt *redis.Options, local LocalCacheOptions) *Client {
+	return NewClient(opt).WithLocalCache(local)
+}
+
+// WithLocalCache serves Get and HGet of c from an in-process LRU in front of
+// Redis and returns c. Set, Del, HSet, HDel and GetSet through any such
+// client broadcast the keys they change over pub/sub, so every instance
+// drops its local copy. Call it once, before c is used.
+func (c *Client) WithLocalCache(local LocalCacheOptions) *Client {
+	c.local = newLocalCache(c.UniversalClient, local)
+	return c
+}
+
+// Close stops the invalidation subscriber, if any, and closes the client.
+func (c *Client) Close() error {
+	if c.local != nil {
+		c.local.close()
+	}
+	return c.UniversalClient.Close()
+}
+
+// CacheStats returns the read counters of the client. Redis counters only
+// cover reads made by Get and HGet.
+func (c *Client) CacheStats() CacheStats {
+	return CacheStats{
+		LocalHits:   atomic.LoadUint64(&c.stats.LocalHits),
+		LocalMisses: atomic.LoadUint64(&c.stats.LocalMisses),
+		RedisHits:   atomic.LoadUint64(&c.stats.RedisHits),
+		RedisMisses: atomic.LoadUint64(&c.stats.RedisMisses),
+	}
+}
+
+// CacheCollector returns a prometheus collector exporting CacheStats as
+// <namespace>_redisx_cache_reads_total{tier, result}.
+func (c *Client) CacheCollector(namespace string) prometheus.Collector {
+	return &cacheCollector{
+		client: c,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "redisx", "cache_reads_total"),
+			"Cache reads by tier and result.",
+			[]string{"tier", "result"}, nil,
+		),
+	}
+}
+
+type cacheCollector struct {
+	client *Client
+	desc   *prometheus.Desc
+}
+
+func (cc *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.desc
+}
+
+func (cc *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := cc.client.CacheStats()
+	ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(s.LocalHits), TierLocal, "hit")
+	ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(s.LocalMisses), TierLocal, "miss")
+	ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(s.RedisHits), TierRedis, "hit")
+	ch <- prometheus.MustNewConstMetric(cc.desc, prometheus.CounterValue, float64(s.RedisMisses), TierRedis, "miss")
+}
+
+func (c *Client) countRedis(err error) {
+	if err == redis.Nil {
+		atomic.AddUint64(&c.stats.RedisMisses, 1)
+	} else if err == nil {
+		atomic.AddUint64(&c.stats.RedisHits, 1)
+	}
+}
+
+// localGet returns the locally cached value of key, or of field of hash key
+// when field is not empty.
+func (c *Client) localGet(key, field string) (string, bool) {
+	if c.local == nil {
+		return "", false
+	}
+	val, ok := c.local.get(key, field)
+	if ok {
+		atomic.AddUint64(&c.stats.LocalHits, 1)
+	} else {
+		atomic.AddUint64(&c.stats.LocalMisses, 1)
+	}
+	return val, ok
+}
+
+// getWithTTL reads key, or field of hash key when field is not empty,
+// together with the remaining TTL of key, so the local tier never serves a
+// value longer than Redis would. A negative TTL means the key does not
+// expire.
+func (c *Client) getWithTTL(ctx context.Context, key, field string) (string, time.Duration, error) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := c.UniversalClient.Pipelined(ctx, func(p redis.Pipeliner) error {
+		if field == "" {
+			get = p.Get(ctx, key)
+		} else {
+			get = p.HGet(ctx, key, field)
+		}
+		pttl = p.PTTL(ctx, key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return "", 0, err
+	}
+
+	val, err := get.Result()
+	return val, pttl.Val(), err
+}
+
+// invalidate drops keys locally and broadcasts them to other instances.
+func (c *Client) invalidate(ctx context.Context, keys ...string) {
+	if c.local == nil {
+		return
+	}
+	c.local.remove(keys...)
+
+	b, _ := json.Marshal(keys)
+	if err := c.UniversalClient.Publish(ctx, c.local.opt.Channel, b).Err(); err != nil {
+		logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+			"keys":  keys,
+			"error": err,
+		}).Error("redis invalidate publish error")
+	}
+}
+
+type localEntry struct {
+	key     string
+	val     string
+	hasVal  bool
+	fields  map[string]string
+	expires time.Time
+}
+
+// localCache is an LRU of keys with a TTL, kept in sync through pub/sub.
+type localCache struct {
+	opt    LocalCacheOptions
+	pubsub *redis.PubSub
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+	// gen changes on every invalidation, so reads racing one are not cached.
+	gen uint64
+}
+
+func newLocalCache(client redis.UniversalClient, opt LocalCacheOptions) *localCache {
+	if opt.Size == 0 {
+		opt.Size = DefaultLocalCacheOptions.Size
+	}
+	if opt.TTL == 0 {
+		opt.TTL = DefaultLocalCacheOptions.TTL
+	}
+	if opt.Channel == "" {
+		opt.Channel = DefaultLocalCacheOptions.Channel
+	}
+
+	lc := &localCache{
+		opt:     opt,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	lc.pubsub = client.Subscribe(context.Background(), opt.Channel)
+	go lc.listen()
+	return lc
+}
+
+func (lc *localCache) listen() {
+	for msg := range lc.pubsub.Channel() {
+		var keys []string
+		if err := json.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+			logx.WithSeverityWarn(context.Background()).WithFields(logrus.Fields{
+				"channel": msg.Channel,
+				"error":   err,
+			}).Warn("redis invalidate message ignored")
+			continue
+		}
+		lc.remove(keys...)
+	}
+}
+
+func (lc *localCache) close() {
+	lc.pubsub.Close()
+}
+
+func (lc *localCache) generation() uint64 {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.gen
+}
+
+func (lc *localCache) get(key, field string) (string, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	el, ok := lc.entries[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*localEntry)
+	if time.Now().After(e.expires) {
+		lc.ll.Remove(el)
+		delete(lc.entries, key)
+		return "", false
+	}
+	lc.ll.MoveToFront(el)
+
+	if field == "" {
+		return e.val, e.hasVal
+	}
+	val, ok := e.fields[field]
+	return val, ok
+}
+
+// set caches val for key, or for field of hash key, unless an invalidation
+// happened since gen was read. The entry expires after the local TTL or ttl,
+// the remaining Redis TTL of key, whichever is sooner.
+func (lc *localCache) set(gen uint64, key, field, val string, ttl time.Duration) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if gen != lc.gen {
+		return
+	}
+
+	expires := time.Now().Add(lc.opt.TTL)
+	if ttl > 0 {
+		if at := time.Now().Add(ttl); at.Before(expires) {
+			expires = at
+		}
+	}
+
+	var e *localEntry
+	if el, ok := lc.entries[key]; ok {
+		e = el.Value.(*localEntry)
+		if expires.Before(e.expires) {
+			e.expires = expires
+		}
+		lc.ll.MoveToFront(el)
+	} else {
+		e = &localEntry{key: key, expires: expires}
+		lc.entries[key] = lc.ll.PushFront(e)
+		if lc.ll.Len() > lc.opt.Size {
+			oldest := lc.ll.Back()
+			lc.ll.Remove(oldest)
+			delete(lc.entries, oldest.Value.(*localEntry).key)
+		}
+	}
+
+	if field == "" {
+		e.val, e.hasVal = val, true
+		return
+	}
+	if e.fields == nil {
+		e.fields = make(map[string]string)
+	}
+	e.fields[field] = val
+}
+
+func (lc *localCache) remove(keys ...string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	lc.gen++
+	for _, key := range keys {
+		if el, ok := lc.entries[key]; ok {
+			lc.ll.Remove(el)
+			delete(lc.entries, key)
+		}
+	}
+}
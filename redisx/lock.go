@@ -0,0 +1,275 @@
+package redisx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/logx"
+)
+
+// Lock errors, check them with errors.Is.
+var (
+	ErrNotObtained = errors.New("redisx: lock not obtained")
+	ErrLockNotHeld = errors.New("redisx: lock not held")
+)
+
+var (
+	obtainScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("incr", KEYS[2])
+end
+return 0`)
+
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+	refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// LockOptions tunes Obtain. The zero value tries once without renewal.
+type LockOptions struct {
+	// RetryTimeout is how long Obtain keeps retrying a held lock.
+	RetryTimeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the jittered exponential wait between
+	// retries. Defaults are 10ms and 500ms; MaxBackoff below MinBackoff is
+	// raised to it.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// AutoRenew refreshes the lock every third of its TTL until it is
+	// released or the context passed to Obtain is done.
+	AutoRenew bool
+}
+
+// Lock is a held distributed lock.
+type Lock struct {
+	client *Client
+	key    string
+	token  string
+	ttl    time.Duration
+	fence  int64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	lost     chan struct{}
+}
+
+// Obtain takes the lock on key for ttl with SET NX PX and a random token.
+// It returns ErrNotObtained when the lock is still held by someone else once
+// the options' retries are exhausted.
+func (c *Client) Obtain(ctx context.Context, key string, ttl time.Duration, opt *LockOptions) (*Lock, error) {
+	if opt == nil {
+		opt = &LockOptions{}
+	}
+	minBackoff, maxBackoff := opt.MinBackoff, opt.MaxBackoff
+	if minBackoff == 0 {
+		minBackoff = 10 * time.Millisecond
+	}
+	if maxBackoff == 0 {
+		maxBackoff = 500 * time.Millisecond
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	deadline := start.Add(opt.RetryTimeout)
+	attempts := 0
+	for {
+		attempts++
+		fence, err := obtainScript.Run(ctx, c.UniversalClient, []string{lockKey(key), fenceKey(key)}, token, ttl.Milliseconds()).Int64()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if fence > 0 {
+			logx.WithContext(ctx).WithFields(logrus.Fields{
+				"key":      key,
+				"fence":    fence,
+				"attempts": attempts,
+				"duration": time.Since(start).String(),
+			}).Info("redis lock obtain information")
+
+			l := &Lock{
+				client: c,
+				key:    key,
+				token:  token,
+				ttl:    ttl,
+				fence:  fence,
+				stop:   make(chan struct{}),
+				lost:   make(chan struct{}),
+			}
+			if opt.AutoRenew {
+				go l.watchdog(ctx)
+			}
+			return l, nil
+		}
+
+		wait := backoff(attempts, minBackoff, maxBackoff)
+		if time.Now().Add(wait).After(deadline) {
+			logx.WithContext(ctx).WithFields(logrus.Fields{
+				"key":      key,
+				"attempts": attempts,
+				"duration": time.Since(start).String(),
+			}).Info("redis lock not obtained information")
+			return nil, errors.WithStack(ErrNotObtained)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Key returns the locked key.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the random value identifying this holder.
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence returns the fencing token, which increases every time the key is
+// locked. Pass it along with writes so stale holders can be rejected.
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Lost is closed when auto-renewal fails and the lock may be held by
+// someone else.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Refresh extends the lock to ttl. It returns ErrLockNotHeld when the lock
+// expired or was taken over.
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	start := time.Now()
+	ok, err := refreshScript.Run(ctx, l.client.UniversalClient, []string{lockKey(l.key)}, l.token, ttl.Milliseconds()).Int64()
+
+	logx.WithContext(ctx).WithFields(logrus.Fields{
+		"key":      l.key,
+		"fence":    l.fence,
+		"ttl":      ttl.String(),
+		"duration": time.Since(start).String(),
+	}).Info("redis lock refresh information")
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if ok == 0 {
+		return errors.WithStack(ErrLockNotHeld)
+	}
+	return nil
+}
+
+// Release unlocks the key if this lock still holds it, using a Lua script so
+// another holder's lock is never deleted. It returns ErrLockNotHeld when the
+// lock had already expired.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+
+	start := time.Now()
+	ok, err := releaseScript.Run(ctx, l.client.UniversalClient, []string{lockKey(l.key)}, l.token).Int64()
+
+	logx.WithContext(ctx).WithFields(logrus.Fields{
+		"key":      l.key,
+		"fence":    l.fence,
+		"duration": time.Since(start).String(),
+	}).Info("redis lock release information")
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if ok == 0 {
+		return errors.WithStack(ErrLockNotHeld)
+	}
+	return nil
+}
+
+func (l *Lock) watchdog(ctx context.Context) {
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx, l.ttl); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+					"key":   l.key,
+					"fence": l.fence,
+					"error": err,
+				}).Error("redis lock renewal error")
+				close(l.lost)
+				return
+			}
+		}
+	}
+}
+
+// lockKey and fenceKey share a hash tag so the obtain script touches a
+// single Cluster slot.
+func lockKey(key string) string {
+	return "lock:{" + key + "}"
+}
+
+func fenceKey(key string) string {
+	return "lock:{" + key + "}:fence"
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// backoff returns a fully jittered exponential wait for attempt, between
+// min and max.
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	if max < min {
+		max = min
+	}
+	d := float64(min) * math.Pow(2, float64(attempt-1))
+	if d > float64(max) {
+		d = float64(max)
+	}
+	return min + time.Duration(mrand.Int63n(int64(d-float64(min))+1))
+}
@@ -0,0 +1,33 @@
+package redisx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+	}{
+		{name: "defaults", min: 10 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "equal bounds", min: 50 * time.Millisecond, max: 50 * time.Millisecond},
+		{name: "max below min", min: 100 * time.Millisecond, max: 10 * time.Millisecond},
+		{name: "zero", min: 0, max: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			max := tt.max
+			if max < tt.min {
+				max = tt.min
+			}
+			for attempt := 1; attempt <= 64; attempt++ {
+				d := backoff(attempt, tt.min, tt.max)
+				if d < tt.min || d > max {
+					t.Fatalf("backoff(%d, %v, %v) = %v, want within [%v, %v]", attempt, tt.min, tt.max, d, tt.min, max)
+				}
+			}
+		})
+	}
+}
@@ -2,28 +2,88 @@ package redisx
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/tOnkowzl/libs/logx"
+	"golang.org/x/sync/singleflight"
 )
 
+// Client wraps a standalone, Sentinel failover or Cluster client with
+// logging. The embedded redis.UniversalClient gives access to every other
+// command.
 type Client struct {
-	*redis.Client
+	redis.UniversalClient
+
+	// Codec encodes values Set does not write natively, such as structs,
+	// and decodes them in Bind. Default is JSON.
+	Codec Codec
+
+	group singleflight.Group
+	local *localCache
+	stats CacheStats
 }
 
+// NewClient returns a client of a standalone Redis server.
 func NewClient(opt *redis.Options) *Client {
+	return Wrap(redis.NewClient(opt))
+}
+
+// NewFailoverClient returns a client of the master of a Sentinel monitored
+// deployment.
+func NewFailoverClient(opt *redis.FailoverOptions) *Client {
+	return Wrap(redis.NewFailoverClient(opt))
+}
+
+// NewClusterClient returns a client of a Redis Cluster.
+func NewClusterClient(opt *redis.ClusterOptions) *Client {
+	return Wrap(redis.NewClusterClient(opt))
+}
+
+// NewUniversalClient returns a standalone, failover or cluster client
+// depending on opt, see redis.NewUniversalClient.
+func NewUniversalClient(opt *redis.UniversalOptions) *Client {
+	return Wrap(redis.NewUniversalClient(opt))
+}
+
+// Wrap returns a client over an existing go-redis client.
+func Wrap(client redis.UniversalClient) *Client {
 	return &Client{
-		redis.NewClient(opt),
+		UniversalClient: client,
 	}
 }
 
 func (c *Client) Get(ctx context.Context, key string) *Bind {
 	start := time.Now()
-	val, err := c.Client.Get(ctx, key).Result()
+	if val, ok := c.localGet(key, ""); ok {
+		logx.WithContext(ctx).WithFields(logrus.Fields{
+			"key":      key,
+			"value":    val,
+			"tier":     TierLocal,
+			"duration": time.Since(start).String(),
+		}).Info("redis get information")
+
+		return &Bind{Val: val, codec: c.codec()}
+	}
+
+	var gen uint64
+	if c.local != nil {
+		gen = c.local.generation()
+	}
+	var val string
+	var err error
+	if c.local != nil {
+		var ttl time.Duration
+		val, ttl, err = c.getWithTTL(ctx, key, "")
+		if err == nil {
+			c.local.set(gen, key, "", val, ttl)
+		}
+	} else {
+		val, err = c.UniversalClient.Get(ctx, key).Result()
+	}
+	c.countRedis(err)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -32,14 +92,20 @@ func (c *Client) Get(ctx context.Context, key string) *Bind {
 	}).Info("redis get information")
 
 	return &Bind{
-		Val: val,
-		Err: errors.WithStack(err),
+		Val:   val,
+		Err:   errors.WithStack(err),
+		codec: c.codec(),
 	}
 }
 
 func (c *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	start := time.Now()
-	err := c.Client.Set(ctx, key, value, expiration).Err()
+	arg, err := c.encodeArg(value)
+	if err != nil {
+		return err
+	}
+	err = c.UniversalClient.Set(ctx, key, arg, expiration).Err()
+	c.invalidate(ctx, key)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -52,7 +118,8 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 
 func (c *Client) Del(ctx context.Context, keys ...string) error {
 	start := time.Now()
-	err := c.Client.Del(ctx, keys...).Err()
+	err := c.del(ctx, keys...)
+	c.invalidate(ctx, keys...)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"keys":     keys,
@@ -62,9 +129,31 @@ func (c *Client) Del(ctx context.Context, keys ...string) error {
 	return errors.WithStack(err)
 }
 
+// del deletes keys one by one on a cluster, where keys of one DEL must share
+// a slot.
+func (c *Client) del(ctx context.Context, keys ...string) error {
+	cluster, ok := c.UniversalClient.(*redis.ClusterClient)
+	if !ok || len(keys) < 2 {
+		return c.UniversalClient.Del(ctx, keys...).Err()
+	}
+
+	_, err := cluster.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
 func (c *Client) HSet(ctx context.Context, key string, values ...interface{}) error {
 	start := time.Now()
-	err := c.Client.HSet(ctx, key, values...).Err()
+	args, err := c.encodeHashArgs(values)
+	if err != nil {
+		return err
+	}
+	err = c.UniversalClient.HSet(ctx, key, args...).Err()
+	c.invalidate(ctx, key)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -76,7 +165,33 @@ func (c *Client) HSet(ctx context.Context, key string, values ...interface{}) er
 
 func (c *Client) HGet(ctx context.Context, key, field string) *Bind {
 	start := time.Now()
-	val, err := c.Client.HGet(ctx, key, field).Result()
+	if val, ok := c.localGet(key, field); ok {
+		logx.WithContext(ctx).WithFields(logrus.Fields{
+			"key":      key,
+			"value":    val,
+			"tier":     TierLocal,
+			"duration": time.Since(start).String(),
+		}).Info("redis hget information")
+
+		return &Bind{Val: val, codec: c.codec()}
+	}
+
+	var gen uint64
+	if c.local != nil {
+		gen = c.local.generation()
+	}
+	var val string
+	var err error
+	if c.local != nil {
+		var ttl time.Duration
+		val, ttl, err = c.getWithTTL(ctx, key, field)
+		if err == nil {
+			c.local.set(gen, key, field, val, ttl)
+		}
+	} else {
+		val, err = c.UniversalClient.HGet(ctx, key, field).Result()
+	}
+	c.countRedis(err)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -85,14 +200,15 @@ func (c *Client) HGet(ctx context.Context, key, field string) *Bind {
 	}).Info("redis hget information")
 
 	return &Bind{
-		Val: val,
-		Err: errors.WithStack(err),
+		Val:   val,
+		Err:   errors.WithStack(err),
+		codec: c.codec(),
 	}
 }
 
 func (c *Client) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
 	start := time.Now()
-	cmd := c.Client.HGetAll(ctx, key)
+	cmd := c.UniversalClient.HGetAll(ctx, key)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -105,7 +221,8 @@ func (c *Client) HGetAll(ctx context.Context, key string) *redis.StringStringMap
 
 func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
 	start := time.Now()
-	err := c.Client.HDel(ctx, key, fields...).Err()
+	err := c.UniversalClient.HDel(ctx, key, fields...).Err()
+	c.invalidate(ctx, key)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -117,7 +234,12 @@ func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
 
 func (c *Client) GetSet(ctx context.Context, key string, value interface{}) *Bind {
 	start := time.Now()
-	val, err := c.Client.GetSet(ctx, key, value).Result()
+	arg, err := c.encodeArg(value)
+	if err != nil {
+		return &Bind{Err: err}
+	}
+	val, err := c.UniversalClient.GetSet(ctx, key, arg).Result()
+	c.invalidate(ctx, key)
 
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":      key,
@@ -127,21 +249,33 @@ func (c *Client) GetSet(ctx context.Context, key string, value interface{}) *Bin
 	}).Info("redis getset information")
 
 	return &Bind{
-		Val: val,
-		Err: errors.WithStack(err),
+		Val:   val,
+		Err:   errors.WithStack(err),
+		codec: c.codec(),
 	}
 }
 
 type Bind struct {
 	Val string
 	Err error
+
+	codec Codec
 }
 
+// Bind decodes Val into i, mirroring how Set, HSet and GetSet encode: when
+// i points to a type they write natively, see encodeArg, Val is parsed as
+// go-redis Scan does; anything else is decoded with the codec of the client
+// that read it. Values from Remember are always JSON.
 func (b *Bind) Bind(i interface{}) error {
 	if b.Err != nil {
 		return b.Err
 	}
 
-	err := json.Unmarshal([]byte(b.Val), i)
-	return errors.WithStack(err)
+	if b.codec == nil {
+		return JSON.Unmarshal([]byte(b.Val), i)
+	}
+	if isNativeDest(i) {
+		return errors.WithStack(redis.NewStringResult(b.Val, nil).Scan(i))
+	}
+	return b.codec.Unmarshal([]byte(b.Val), i)
 }
@@ -0,0 +1,180 @@
+package redisx
+
+import (
+	"context"
+	"encoding/json"
+	mrand "math/rand"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tOnkowzl/libs/contextx"
+	"github.com/tOnkowzl/libs/logx"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound is returned by a Loader for values that do not exist. Remember
+// caches it for NegativeTTL; check it with errors.Is.
+var ErrNotFound = errors.New("redisx: not found")
+
+// Loader loads the value of a cache miss. The value is stored as JSON.
+type Loader func(ctx context.Context) (interface{}, error)
+
+// RememberOptions tunes Remember.
+type RememberOptions struct {
+	// NegativeTTL is how long ErrNotFound from the loader is cached.
+	// Zero does not cache it.
+	NegativeTTL time.Duration
+
+	// Jitter adds up to this fraction of the TTL, at random, so keys
+	// written together do not expire together.
+	Jitter float64
+
+	// StaleTTL keeps serving a value for this long after its TTL while it
+	// is refreshed in the background. Zero reloads in the foreground.
+	StaleTTL time.Duration
+
+	// RefreshTimeout bounds a loader call, on a miss or in a background
+	// refresh. Default is 10 seconds.
+	RefreshTimeout time.Duration
+}
+
+// DefaultRememberOptions are the options of Remember.
+var DefaultRememberOptions = RememberOptions{
+	Jitter:         0.1,
+	RefreshTimeout: 10 * time.Second,
+}
+
+// cacheEntry is the stored form of a remembered value.
+type cacheEntry struct {
+	Value    json.RawMessage `json:"v,omitempty"`
+	NotFound bool            `json:"nf,omitempty"`
+	// FreshUntil is in unix milliseconds.
+	FreshUntil int64 `json:"fu"`
+}
+
+// Remember returns the value cached at key, or calls loader and caches its
+// result for ttl. Concurrent misses of the same key share one loader call,
+// which runs detached from ctx so one caller giving up does not fail the
+// others.
+func (c *Client) Remember(ctx context.Context, key string, ttl time.Duration, loader Loader) *Bind {
+	return c.RememberWithOptions(ctx, key, ttl, DefaultRememberOptions, loader)
+}
+
+// RememberWithOptions is Remember with opt.
+func (c *Client) RememberWithOptions(ctx context.Context, key string, ttl time.Duration, opt RememberOptions, loader Loader) *Bind {
+	if opt.RefreshTimeout == 0 {
+		opt.RefreshTimeout = DefaultRememberOptions.RefreshTimeout
+	}
+
+	start := time.Now()
+	state := "hit"
+	defer func() {
+		logx.WithContext(ctx).WithFields(logrus.Fields{
+			"key":      key,
+			"state":    state,
+			"duration": time.Since(start).String(),
+		}).Info("redis remember information")
+	}()
+
+	b, err := c.UniversalClient.Get(ctx, key).Bytes()
+	if err != nil && err != redis.Nil {
+		return &Bind{Err: errors.WithStack(err)}
+	}
+
+	if err == nil {
+		var e cacheEntry
+		if json.Unmarshal(b, &e) == nil {
+			if time.Now().UnixNano()/int64(time.Millisecond) >= e.FreshUntil {
+				state = "stale"
+				c.refresh(ctx, key, ttl, opt, loader)
+			}
+			return e.bind()
+		}
+		// not written by Remember, overwrite it
+	}
+
+	state = "miss"
+	select {
+	case <-ctx.Done():
+		return &Bind{Err: errors.WithStack(ctx.Err())}
+	case res := <-c.loadShared(ctx, key, ttl, opt, loader):
+		if res.Err != nil {
+			return &Bind{Err: res.Err}
+		}
+		return res.Val.(*cacheEntry).bind()
+	}
+}
+
+// refresh reloads key in the background.
+func (c *Client) refresh(ctx context.Context, key string, ttl time.Duration, opt RememberOptions, loader Loader) {
+	ch := c.loadShared(ctx, key, ttl, opt, loader)
+
+	go func() {
+		if res := <-ch; res.Err != nil {
+			logx.WithSeverityError(ctx).WithFields(logrus.Fields{
+				"key":   key,
+				"error": res.Err,
+			}).Error("redis remember refresh error")
+		}
+	}()
+}
+
+// loadShared loads key once for all concurrent callers, detached from the
+// request context but keeping its request ID for logs.
+func (c *Client) loadShared(ctx context.Context, key string, ttl time.Duration, opt RememberOptions, loader Loader) <-chan singleflight.Result {
+	id := contextx.GetID(ctx)
+
+	return c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(contextx.SetID(context.Background(), id), opt.RefreshTimeout)
+		defer cancel()
+
+		return c.load(ctx, key, ttl, opt, loader)
+	})
+}
+
+func (c *Client) load(ctx context.Context, key string, ttl time.Duration, opt RememberOptions, loader Loader) (*cacheEntry, error) {
+	v, err := loader(ctx)
+	e := &cacheEntry{}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if opt.NegativeTTL <= 0 {
+			return nil, err
+		}
+		e.NotFound = true
+		ttl = opt.NegativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if e.Value, err = json.Marshal(v); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if opt.Jitter > 0 {
+		ttl += time.Duration(mrand.Int63n(int64(float64(ttl)*opt.Jitter) + 1))
+	}
+	e.FreshUntil = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	expiration := ttl
+	if !e.NotFound {
+		expiration += opt.StaleTTL
+	}
+	if err := c.UniversalClient.Set(ctx, key, b, expiration).Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.invalidate(ctx, key)
+	return e, nil
+}
+
+func (e *cacheEntry) bind() *Bind {
+	if e.NotFound {
+		return &Bind{Err: errors.WithStack(ErrNotFound)}
+	}
+	return &Bind{Val: string(e.Value)}
+}
@@ -0,0 +1,128 @@
+package redisx
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRemember(t *testing.T) {
+	ctx := context.Background()
+	opt := RememberOptions{NegativeTTL: time.Minute, RefreshTimeout: time.Second}
+
+	tests := []struct {
+		name string
+		// loaded is returned by the loader on each call
+		loaded  []interface{}
+		err     error
+		calls   int
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "miss then hit",
+			loaded: []interface{}{"a", "b"},
+			calls:  1,
+			want:   "a",
+		},
+		{
+			name:    "not found is cached",
+			err:     ErrNotFound,
+			calls:   1,
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "other errors are not cached",
+			err:     errors.New("boom"),
+			calls:   2,
+			wantErr: errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t)
+
+			var calls int32
+			loader := func(ctx context.Context) (interface{}, error) {
+				n := atomic.AddInt32(&calls, 1)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return tt.loaded[n-1], nil
+			}
+
+			for i := 0; i < 2; i++ {
+				var got string
+				err := c.RememberWithOptions(ctx, "k", time.Minute, opt, loader).Bind(&got)
+				switch {
+				case tt.wantErr != nil:
+					if err == nil || err.Error() != tt.wantErr.Error() {
+						t.Fatalf("call %d error = %v, want %v", i+1, err, tt.wantErr)
+					}
+				case err != nil:
+					t.Fatal(err)
+				case got != tt.want:
+					t.Fatalf("call %d = %q, want %q", i+1, got, tt.want)
+				}
+			}
+
+			if n := int(atomic.LoadInt32(&calls)); n != tt.calls {
+				t.Errorf("loader calls = %d, want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRememberStale(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+
+	// a value past its fresh time but within StaleTTL
+	stale, _ := json.Marshal(&cacheEntry{
+		Value:      json.RawMessage(`"old"`),
+		FreshUntil: time.Now().Add(-time.Second).UnixNano() / int64(time.Millisecond),
+	})
+	mr.Set("k", string(stale))
+
+	refreshed := make(chan struct{})
+	var once sync.Once
+	loader := func(ctx context.Context) (interface{}, error) {
+		defer once.Do(func() { close(refreshed) })
+		return "new", nil
+	}
+
+	opt := RememberOptions{StaleTTL: time.Minute, RefreshTimeout: time.Second}
+	var got string
+	if err := c.RememberWithOptions(ctx, "k", time.Minute, opt, loader).Bind(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "old" {
+		t.Errorf("stale read = %q, want the stale value", got)
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale value was not refreshed")
+	}
+
+	// the refresh writes after the loader returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		got = ""
+		err := c.RememberWithOptions(ctx, "k", time.Minute, opt, loader).Bind(&got)
+		if err == nil && got == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("read after refresh = %q, %v, want new", got, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/tOnkowzl/libs/viperx
 go 1.16
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.7.1
 	github.com/tOnkowzl/libs/logx v0.0.28
@@ -2,13 +2,21 @@ package viperx
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/tOnkowzl/libs/logx"
 )
 
+var (
+	watchOnce sync.Once
+	watchMu   sync.Mutex
+	watchers  []func()
+)
+
 func log(ctx context.Context, key string, value interface{}) {
 	logx.WithContext(ctx).WithFields(logrus.Fields{
 		"key":   key,
@@ -81,3 +89,40 @@ func GetDuration(ctx context.Context, key string) time.Duration {
 	log(ctx, key, value)
 	return value
 }
+
+func GetStringSlice(ctx context.Context, key string) []string {
+	value := viper.GetStringSlice(key)
+	log(ctx, key, value)
+	return value
+}
+
+func UnmarshalKey(ctx context.Context, key string, rawVal interface{}) error {
+	err := viper.UnmarshalKey(key, rawVal)
+	log(ctx, key, rawVal)
+	return err
+}
+
+// Watch calls fn whenever the config file changes, starting to watch it on
+// first use. Unlike viper.OnConfigChange, every registered fn is called.
+func Watch(fn func()) {
+	watchMu.Lock()
+	watchers = append(watchers, fn)
+	watchMu.Unlock()
+
+	watchOnce.Do(func() {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			logx.WithContext(context.Background()).WithFields(logrus.Fields{
+				"file": e.Name,
+				"op":   e.Op.String(),
+			}).Info("viper config change information")
+
+			watchMu.Lock()
+			fns := append([]func(){}, watchers...)
+			watchMu.Unlock()
+			for _, fn := range fns {
+				fn()
+			}
+		})
+		viper.WatchConfig()
+	})
+}